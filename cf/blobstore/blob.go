@@ -16,14 +16,17 @@ import (
 	"github.com/gosemver/aws_aws-sdk-go_v1.4.3-1-g1f24fa1/aws/credentials"
 	"github.com/gosemver/aws_aws-sdk-go_v1.4.3-1-g1f24fa1/aws/session"
 	"github.com/gosemver/aws_aws-sdk-go_v1.4.3-1-g1f24fa1/service/s3"
-	"github.com/cloudfoundry-community/go-cfenv"
 )
 
 var settings = config.AppSettings()
 var log = logging.Logger()
 
 type BlobstoreEnv struct {
-	Name string     `env:"go2_blobstore.name"`
+	Name            string `env:"go2_blobstore.name"`
+	AccessKeyID     string `env:",required" vcap:"${go2_blobstore.name},access_key_id"`
+	SecretAccessKey string `env:",required,secret" vcap:"${go2_blobstore.name},secret_access_key"`
+	Endpoint        string `env:",required" vcap:"${go2_blobstore.name},host"`
+	BucketName      string `env:",required" vcap:"${go2_blobstore.name},bucket_name"`
 }
 
 func init() {
@@ -34,7 +37,7 @@ func init() {
 		log.Errorf("Blobstore init error: %v", err)
 		return
 	}
-	log.Debugf("Blobstore env: %v", env)
+	log.Debugf("Blobstore env name: %v endpoint: %v bucket: %v", env.Name, env.Endpoint, env.BucketName)
 
 	initStore(env)
 }
@@ -52,15 +55,12 @@ func initStore(env BlobstoreEnv) {
 	disableSSL := true
 	logLevel := aws.LogDebugWithRequestErrors
 
-	s := settings.GetService(env.Name).(cfenv.Service)
-	accessKeyID := s.Credentials["access_key_id"].(string)
-	secretAccessKey := s.Credentials["secret_access_key"].(string)
-	endpoint := s.Credentials["host"].(string)
+	endpoint := env.Endpoint
 
-	BucketName = s.Credentials["bucket_name"].(string)
+	BucketName = env.BucketName
 
 	Config = aws.Config{
-		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+		Credentials: credentials.NewStaticCredentials(env.AccessKeyID, env.SecretAccessKey, ""),
 		Region:      &region,
 		Endpoint:    &endpoint,
 		DisableSSL:  &disableSSL,
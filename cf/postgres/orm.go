@@ -12,13 +12,26 @@ import (
 
 var engine *xorm.Engine
 
+// InitORM is like OpenORM but panics if the service is not bound or ambiguous.
 func InitORM(env PostgresEnv) *xorm.Engine {
-	uri := settings.PostgresUri(env.Name)
+	eng, err := OpenORM(env)
+	if err != nil {
+		panic(err)
+	}
+	return eng
+}
+
+// OpenORM returns an xorm engine for the postgres service named by env, or the only one bound.
+func OpenORM(env PostgresEnv) (*xorm.Engine, error) {
+	uri, err := settings.LookupPostgresUri(env.Name)
+	if err != nil {
+		return nil, err
+	}
 	log.Infof("Postgres Init ORM uri: %s", maskedUrl(uri))
 
 	eng, err := xorm.NewEngine("postgres", uri)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	eng.ShowSQL(env.ORMShowSQL)
@@ -26,7 +39,7 @@ func InitORM(env PostgresEnv) *xorm.Engine {
 	eng.SetMaxOpenConns(env.MaxOpenConns)
 	eng.SetMaxIdleConns(env.MaxIdleConns)
 
-	return eng
+	return eng, nil
 }
 
 func ORM() *xorm.Engine {
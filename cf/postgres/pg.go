@@ -36,8 +36,8 @@ var database  *sql.DB
 
 type PostgresEnv struct {
 	Name         string     `env:"go2_postgres.name"`
-	MaxOpenConns int        `env:"go2_postgres.connection.max_open"`
-	MaxIdleConns int        `env:"go2_postgres.connection.max_idle"`
+	MaxOpenConns int        `env:"go2_postgres.connection.max_open" envMin:"0"`
+	MaxIdleConns int        `env:"go2_postgres.connection.max_idle" envMin:"0"`
 	ORMEnable    bool       `env:"go2_postgres.orm.enable"`
 	ORMShowSQL   bool       `env:"go2_postgres.orm.show_sql"`
 }
@@ -53,10 +53,27 @@ func init() {
 	log.Debugf("Postgres env: %v", env)
 
 	if env.ORMEnable {
-		engine = InitORM(env)
-		database = engine.DB().DB
+		engine, err = OpenORM(env)
+		if err == nil {
+			database = engine.DB().DB
+		}
 	} else {
-		database = InitDB(env)
+		database, err = OpenDB(env)
+	}
+	if err != nil {
+		log.Errorf("Postgres init error: %v", err)
+		return
+	}
+
+	// pool sizes can be tuned on settings reload
+	_, err = settings.WatchStruct(&env, func(old, new interface{}) {
+		e := new.(*PostgresEnv)
+		log.Infof("Postgres reloaded connection max_open: %v max_idle: %v", e.MaxOpenConns, e.MaxIdleConns)
+		database.SetMaxOpenConns(e.MaxOpenConns)
+		database.SetMaxIdleConns(e.MaxIdleConns)
+	})
+	if err != nil {
+		log.Errorf("Postgres watch error: %v", err)
 	}
 }
 
@@ -66,20 +83,33 @@ func maskedUrl(uri string) string {
 	return fmt.Sprintf("%s://%s:***@%s%s?%s", u.Scheme, u.User.Username(), u.Host, u.Path, u.RawQuery)
 }
 
+// InitDB is like OpenDB but panics if the service is not bound or ambiguous.
 func InitDB(env PostgresEnv) *sql.DB {
-	uri := settings.PostgresUri(env.Name)
+	db, err := OpenDB(env)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// OpenDB opens the database of the postgres service named by env, or the only one bound.
+func OpenDB(env PostgresEnv) (*sql.DB, error) {
+	uri, err := settings.LookupPostgresUri(env.Name)
+	if err != nil {
+		return nil, err
+	}
 	log.Infof("Postgres init DB uri: %s", maskedUrl(uri))
 
 	db, err := sql.Open("postgres", uri)
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	db.SetMaxOpenConns(env.MaxOpenConns)
 	db.SetMaxIdleConns(env.MaxIdleConns)
 
-	return db
+	return db, nil
 }
 
 func Status() bool {
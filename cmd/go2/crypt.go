@@ -0,0 +1,79 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/qiangli/go2/config"
+)
+
+func keygen(args []string) error {
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+func encrypt(args []string) error {
+	key, value, err := cryptArgs("encrypt", args)
+	if err != nil {
+		return err
+	}
+	s, err := config.Encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+func decrypt(args []string) error {
+	key, value, err := cryptArgs("decrypt", args)
+	if err != nil {
+		return err
+	}
+	s, err := config.Decrypt(key, strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+// cryptArgs returns the key and the value to encrypt or decrypt.
+func cryptArgs(name string, args []string) (key []byte, value string, err error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "file holding the base64 encoded key")
+	fs.Parse(args)
+
+	if *keyFile != "" {
+		b, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		key, err = config.ParseKey(string(b))
+	} else {
+		key, err = config.AppSettings().EncryptionKey()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if fs.NArg() > 0 {
+		return key, strings.Join(fs.Args(), " "), nil
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,905 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// docStruct is a struct type with env tagged fields.
+type docStruct struct {
+	Pkg    string
+	Name   string
+	Doc    string
+	Fields []docField
+}
+
+// docField is an env tagged field, nested struct fields are flattened
+// with their keys joined as Parse does.
+type docField struct {
+	Field     string
+	Type      string
+	Key       string
+	Default   string
+	Separator string
+	Required  bool
+	Secret    bool
+	Nonempty  bool
+	Min       string
+	Max       string
+	OneOf     string
+	Pattern   string
+	Format    string
+	Vcap      string
+	Doc       string
+
+	prefixed bool // renamed by the envPrefix of a nested struct
+}
+
+func doc(args []string) error {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown, manifest or schema")
+	app := fs.String("app", "my-app", "application name in the manifest")
+	dir := fs.String("dir", "", "write a <name>.schema.json file per env value to dir instead of stdout")
+	fs.Parse(args)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	structs, err := scanStructs(patterns)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "markdown":
+		return writeMarkdown(os.Stdout, structs)
+	case "manifest":
+		return writeManifest(os.Stdout, *app, structs)
+	case "schema":
+		schemas := envSchemas(structs)
+		if *dir == "" {
+			return writeJSON(os.Stdout, schemas)
+		}
+		for name, schema := range schemas {
+			f, err := os.Create(filepath.Join(*dir, name+".schema.json"))
+			if err != nil {
+				return err
+			}
+			err = writeJSON(f, schema)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// scanStructs parses the packages in the directories matched by patterns,
+// a directory or a directory followed by /... for all directories below it.
+func scanStructs(patterns []string) ([]docStruct, error) {
+	var dirs []string
+	for _, p := range patterns {
+		if !strings.HasSuffix(p, "/...") {
+			dirs = append(dirs, p)
+			continue
+		}
+		err := filepath.Walk(strings.TrimSuffix(p, "/..."), func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				return nil
+			}
+			name := fi.Name()
+			if path != "." && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := newLoader()
+	var structs []docStruct
+	for _, dir := range dirs {
+		s, err := scanDir(l, dir)
+		if err != nil {
+			return nil, err
+		}
+		structs = append(structs, s...)
+	}
+	return structs, nil
+}
+
+// typeDecl is a struct type declared in a package.
+type typeDecl struct {
+	name string
+	doc  string
+	st   *ast.StructType
+}
+
+func scanDir(l *loader, dir string) ([]docStruct, error) {
+	noTests := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(l.fset, dir, noTests, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var structs []docStruct
+	for _, name := range names {
+		pkg := pkgs[name]
+
+		var files []string
+		for f := range pkg.Files {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+
+		var asts []*ast.File
+		var decls []typeDecl
+		for _, f := range files {
+			asts = append(asts, pkg.Files[f])
+			for _, d := range pkg.Files[f].Decls {
+				gd, ok := d.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					doc := ts.Doc
+					if doc == nil {
+						doc = gd.Doc
+					}
+					decls = append(decls, typeDecl{ts.Name.Name, docText(doc), st})
+				}
+			}
+		}
+
+		s := &scanner{loader: l, pkg: l.add(name, abs, asts), nested: make(map[string]bool)}
+		for _, d := range decls {
+			s.collect(d.st, "", "", nil)
+		}
+		for _, d := range decls {
+			if s.nested[d.name] || !ast.IsExported(d.name) {
+				continue
+			}
+			if fields := s.collect(d.st, "", "", nil); len(fields) > 0 {
+				structs = append(structs, docStruct{Pkg: name, Name: d.name, Doc: d.doc, Fields: fields})
+			}
+		}
+	}
+	return structs, nil
+}
+
+// buildContext locates the packages of nested struct types declared in other packages.
+var buildContext = build.Default
+
+// warnings is where fields that can't be resolved are reported.
+var warnings io.Writer = os.Stderr
+
+// loader parses the packages of the scanned directories and those they import
+// for nested struct types, e.g. elastic.ElasticEnv.
+type loader struct {
+	fset     *token.FileSet
+	files    map[string]*srcFile // by file name
+	imported map[string]*srcPkg  // by import path
+	warned   map[string]bool
+}
+
+func newLoader() *loader {
+	return &loader{
+		fset:     token.NewFileSet(),
+		files:    make(map[string]*srcFile),
+		imported: make(map[string]*srcPkg),
+		warned:   make(map[string]bool),
+	}
+}
+
+// srcPkg is a parsed package.
+type srcPkg struct {
+	name  string
+	dir   string
+	types map[string]*ast.StructType
+	err   error // of loading an imported package
+}
+
+// srcFile is a file of a parsed package.
+type srcFile struct {
+	pkg     *srcPkg
+	imports []*ast.ImportSpec
+}
+
+// add registers the struct types and imports of the files of a package.
+func (l *loader) add(name, dir string, files []*ast.File) *srcPkg {
+	p := &srcPkg{name: name, dir: dir, types: make(map[string]*ast.StructType)}
+	for _, f := range files {
+		l.files[l.fset.Position(f.Pos()).Filename] = &srcFile{pkg: p, imports: f.Imports}
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					p.types[ts.Name.Name] = st
+				}
+			}
+		}
+	}
+	return p
+}
+
+// importPkg loads the package with the import path as seen from srcDir.
+func (l *loader) importPkg(path, srcDir string) *srcPkg {
+	p, ok := l.imported[path]
+	if !ok {
+		p = l.load(path, srcDir)
+		l.imported[path] = p
+	}
+	return p
+}
+
+func (l *loader) load(path, srcDir string) *srcPkg {
+	bp, err := buildContext.Import(path, srcDir, 0)
+	if err != nil {
+		return &srcPkg{err: err}
+	}
+	var files []*ast.File
+	for _, name := range append(bp.GoFiles, bp.CgoFiles...) {
+		f, err := parser.ParseFile(l.fset, filepath.Join(bp.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return &srcPkg{err: err}
+		}
+		files = append(files, f)
+	}
+	return l.add(bp.Name, bp.Dir, files)
+}
+
+// lookup returns the package imported as name by the file f.
+func (l *loader) lookup(f *srcFile, name string) (*srcPkg, error) {
+	var unnamed []string
+	for _, imp := range f.imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		switch {
+		case imp.Name == nil:
+			unnamed = append(unnamed, path)
+		case imp.Name.Name == name:
+			p := l.importPkg(path, f.pkg.dir)
+			return p, p.err
+		}
+	}
+
+	// the name of a package imported without one is only known once it is loaded,
+	// try the paths ending in name first
+	sort.SliceStable(unnamed, func(i, j int) bool {
+		return pathBase(unnamed[i]) == name && pathBase(unnamed[j]) != name
+	})
+	var err error
+	for _, path := range unnamed {
+		p := l.importPkg(path, f.pkg.dir)
+		if p.err == nil && p.name == name {
+			return p, nil
+		}
+		if p.err != nil && err == nil {
+			// e.g. github.com/cloudfoundry-community/go-cfenv for cfenv
+			err = p.err
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("package %s is not imported", name)
+	}
+	return nil, err
+}
+
+func pathBase(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// resolve returns the struct type typ refers to and the package it is declared in, if any,
+// or the error of loading the package of a selector, e.g. elastic.ElasticEnv.
+func (l *loader) resolve(typ ast.Expr) (*ast.StructType, *srcPkg, error) {
+	f := l.files[l.fset.Position(typ.Pos()).Filename]
+	if f == nil {
+		return nil, nil, nil
+	}
+	switch t := typ.(type) {
+	case *ast.StructType:
+		return t, f.pkg, nil
+	case *ast.Ident:
+		return f.pkg.types[t.Name], f.pkg, nil
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return nil, nil, nil
+		}
+		p, err := l.lookup(f, x.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p.types[t.Sel.Name], p, nil
+	}
+	return nil, nil, nil
+}
+
+// warn reports a field that can't be documented as Parse loads it, once.
+func (l *loader) warn(pos token.Pos, format string, a ...interface{}) {
+	msg := fmt.Sprintf("%s: %s", l.fset.Position(pos), fmt.Sprintf(format, a...))
+	if !l.warned[msg] {
+		l.warned[msg] = true
+		fmt.Fprintf(warnings, "warning: %s\n", msg)
+	}
+}
+
+// scanner flattens the env tagged fields of the struct types of a package.
+type scanner struct {
+	*loader
+	pkg    *srcPkg
+	nested map[string]bool // types used as nested structs
+}
+
+func (s *scanner) collect(st *ast.StructType, prefix, path string, seen []*ast.StructType) []docField {
+	for _, t := range seen {
+		if t == st {
+			return nil
+		}
+	}
+	seen = append(seen, st)
+
+	var fields []docField
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			t, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(t)
+		}
+
+		var names []string
+		for _, n := range f.Names {
+			if n.IsExported() {
+				names = append(names, n.Name)
+			}
+		}
+		if len(f.Names) == 0 {
+			names = []string{embeddedName(f.Type)}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		_, hasEnv := tag.Lookup("env")
+		_, hasVcap := tag.Lookup("vcap")
+		_, hasPrefix := tag.Lookup("envPrefix")
+
+		typ := f.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		nested, pkg, err := s.structType(typ)
+		if err != nil && (hasEnv || hasPrefix) {
+			s.warn(typ.Pos(), "cannot resolve %s: %v", types.ExprString(typ), err)
+		}
+		if nested != nil {
+			if id, ok := typ.(*ast.Ident); ok && pkg == s.pkg {
+				s.nested[id.Name] = true
+			}
+			key, _ := splitTag(tag.Get("env"))
+			for _, name := range names {
+				nf := s.collect(nested, joinKey(prefix, key), joinKey(path, name), seen)
+				if envPrefix := tag.Get("envPrefix"); envPrefix != "" {
+					if err := renameFields(nf, envPrefix); err != nil {
+						s.warn(f.Pos(), "%v", err)
+					}
+				}
+				fields = append(fields, nf...)
+			}
+			continue
+		}
+
+		if !hasEnv && !hasVcap {
+			continue
+		}
+		key, opts := splitTag(tag.Get("env"))
+		if key != "" {
+			key = joinKey(prefix, key)
+		}
+		for _, name := range names {
+			d := docField{
+				Field:     joinKey(path, name),
+				Type:      types.ExprString(f.Type),
+				Key:       key,
+				Default:   tag.Get("envDefault"),
+				Separator: tag.Get("envSeparator"),
+				Min:       tag.Get("envMin"),
+				Max:       tag.Get("envMax"),
+				OneOf:     tag.Get("envOneOf"),
+				Pattern:   tag.Get("envPattern"),
+				Format:    tag.Get("envFormat"),
+				Vcap:      tag.Get("vcap"),
+				Doc:       docText(f.Doc),
+			}
+			if d.Doc == "" {
+				d.Doc = docText(f.Comment)
+			}
+			for _, o := range opts {
+				switch o {
+				case "required":
+					d.Required = true
+				case "secret", "file":
+					d.Secret = true
+				case "nonempty":
+					d.Nonempty = true
+				}
+			}
+			fields = append(fields, d)
+		}
+	}
+	return fields
+}
+
+// renameFields replaces the env names of the keys of the fields of a nested struct
+// and their references in vcap tags with the envPrefix of the struct, as Parse does.
+// Fields of inner structs with their own envPrefix are not renamed again.
+// The keys must have a single env name, as Parse requires, or none are renamed.
+func renameFields(fields []docField, envPrefix string) error {
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if f.Key != "" && !f.prefixed {
+			names[strings.SplitN(f.Key, ".", 2)[0]] = true
+		}
+	}
+	if len(names) > 1 {
+		var a []string
+		for name := range names {
+			a = append(a, name)
+		}
+		sort.Strings(a)
+		return fmt.Errorf("env prefix %s can't replace several env names %s", envPrefix, strings.Join(a, ", "))
+	}
+	for i := range fields {
+		f := &fields[i]
+		if f.prefixed {
+			continue
+		}
+		f.prefixed = true
+		if name := strings.SplitN(f.Key, ".", 2)[0]; names[name] {
+			f.Key = envPrefix + f.Key[len(name):]
+		}
+		for name := range names {
+			f.Vcap = strings.Replace(f.Vcap, "${"+name+".", "${"+envPrefix+".", -1)
+			f.Vcap = strings.Replace(f.Vcap, "${"+name+"}", "${"+envPrefix+"}", -1)
+		}
+	}
+	return nil
+}
+
+// structType returns the struct type of a nested struct field with env tags and
+// the package it is declared in, if any.
+func (s *scanner) structType(typ ast.Expr) (*ast.StructType, *srcPkg, error) {
+	st, pkg, err := s.resolve(typ)
+	if st == nil || !s.hasEnvTags(st, nil) {
+		return nil, nil, err
+	}
+	return st, pkg, nil
+}
+
+func (s *scanner) hasEnvTags(st *ast.StructType, seen []*ast.StructType) bool {
+	for _, t := range seen {
+		if t == st {
+			return false
+		}
+	}
+	seen = append(seen, st)
+
+	for _, f := range st.Fields.List {
+		if f.Tag != nil {
+			t, _ := strconv.Unquote(f.Tag.Value)
+			tag := reflect.StructTag(t)
+			if _, ok := tag.Lookup("env"); ok {
+				return true
+			}
+			if _, ok := tag.Lookup("vcap"); ok {
+				return true
+			}
+			if _, ok := tag.Lookup("envPrefix"); ok {
+				return true
+			}
+		}
+		typ := f.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if nested, _, _ := s.resolve(typ); nested != nil && s.hasEnvTags(nested, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedName returns the field name of an embedded type, e.g. Type for *pkg.Type, as reflect does.
+func embeddedName(typ ast.Expr) string {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if sel, ok := typ.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return types.ExprString(typ)
+}
+
+func splitTag(tag string) (string, []string) {
+	opts := strings.Split(tag, ",")
+	return opts[0], opts[1:]
+}
+
+func joinKey(prefix, key string) string {
+	switch {
+	case prefix == "":
+		return key
+	case key == "":
+		return prefix
+	}
+	return prefix + "." + key
+}
+
+func docText(g *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(g.Text()), " ")
+}
+
+// notes describes the options and constraints of a field.
+func (f docField) notes() []string {
+	var a []string
+	if f.Required {
+		a = append(a, "required")
+	}
+	if f.Secret {
+		a = append(a, "secret")
+	}
+	if f.Nonempty {
+		a = append(a, "not empty")
+	}
+	if f.Separator != "" {
+		a = append(a, fmt.Sprintf("separated by `%s`", f.Separator))
+	}
+	if f.OneOf != "" {
+		a = append(a, "one of "+strings.Replace(f.OneOf, ",", ", ", -1))
+	}
+	if f.Min != "" {
+		a = append(a, "min "+f.Min)
+	}
+	if f.Max != "" {
+		a = append(a, "max "+f.Max)
+	}
+	if f.Pattern != "" {
+		a = append(a, fmt.Sprintf("pattern `%s`", f.Pattern))
+	}
+	if f.Format != "" {
+		a = append(a, "format "+f.Format)
+	}
+	if f.Vcap != "" {
+		a = append(a, fmt.Sprintf("service credential `%s`", f.Vcap))
+	}
+	return a
+}
+
+func writeMarkdown(w io.Writer, structs []docStruct) error {
+	fmt.Fprintln(w, "# Configuration reference")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Generated by `go2 config doc`, do not edit.")
+
+	for _, s := range structs {
+		fmt.Fprintf(w, "\n## %s.%s\n\n", s.Pkg, s.Name)
+		if s.Doc != "" {
+			fmt.Fprintf(w, "%s\n\n", s.Doc)
+		}
+		fmt.Fprintln(w, "| Key | Field | Type | Default | Description |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+		for _, f := range s.Fields {
+			desc := f.Doc
+			if notes := f.notes(); len(notes) > 0 {
+				if desc != "" {
+					desc += " "
+				}
+				desc += "(" + strings.Join(notes, "; ") + ")"
+			}
+			key := ""
+			if f.Key != "" {
+				key = "`" + f.Key + "`"
+			}
+			def := ""
+			if f.Default != "" {
+				def = "`" + f.Default + "`"
+			}
+			fmt.Fprintf(w, "| %s | %s | `%s` | %s | %s |\n",
+				cell(key), cell(f.Field), cell(f.Type), cell(def), cell(desc))
+		}
+
+		values := envValues([]docStruct{s})
+		var names []string
+		for name, v := range values {
+			if _, ok := v.(map[string]interface{}); ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b, err := json.MarshalIndent(values[name], "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "\nExample:\n\n```\n%s=%s\n```\n", name, b)
+		}
+	}
+	return nil
+}
+
+func cell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+func writeManifest(w io.Writer, app string, structs []docStruct) error {
+	values := envValues(structs)
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "applications:")
+	fmt.Fprintf(w, "- name: %s\n", app)
+	fmt.Fprintln(w, "  env:")
+	for _, name := range names {
+		switch v := values[name].(type) {
+		case map[string]interface{}:
+			b, err := json.MarshalIndent(v, "      ", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "    %s: |\n      %s\n", name, b)
+		default:
+			b, _ := json.Marshal(v)
+			fmt.Fprintf(w, "    %s: %s\n", name, strconv.Quote(strings.Trim(string(b), `"`)))
+		}
+	}
+	return nil
+}
+
+// envValues returns sample env values built from the defaults of the fields,
+// JSON objects for dotted keys.
+func envValues(structs []docStruct) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			if f.Key == "" {
+				continue
+			}
+			p := strings.Split(f.Key, ".")
+			if len(p) == 1 {
+				values[p[0]] = f.sample()
+				continue
+			}
+			m, ok := values[p[0]].(map[string]interface{})
+			if !ok {
+				m = make(map[string]interface{})
+				values[p[0]] = m
+			}
+			for _, k := range p[1 : len(p)-1] {
+				n, ok := m[k].(map[string]interface{})
+				if !ok {
+					n = make(map[string]interface{})
+					m[k] = n
+				}
+				m = n
+			}
+			m[p[len(p)-1]] = f.sample()
+		}
+	}
+	return values
+}
+
+// sample returns the default of the field as a JSON value, or its zero value.
+func (f docField) sample() interface{} {
+	typ := strings.TrimPrefix(f.Type, "*")
+	if strings.HasPrefix(typ, "[]") {
+		a := []interface{}{}
+		if f.Default == "" {
+			return a
+		}
+		sep := f.Separator
+		if sep == "" {
+			sep = ","
+		}
+		for _, s := range strings.Split(f.Default, sep) {
+			a = append(a, sampleValue(strings.TrimPrefix(typ, "[]"), s))
+		}
+		return a
+	}
+	if strings.HasPrefix(typ, "map[") {
+		return map[string]interface{}{}
+	}
+	return sampleValue(typ, f.Default)
+}
+
+func sampleValue(typ, s string) interface{} {
+	switch schemaType(typ) {
+	case "boolean":
+		b, _ := strconv.ParseBool(s)
+		return b
+	case "integer":
+		i, _ := strconv.ParseInt(s, 10, 64)
+		return i
+	case "number":
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	return s
+}
+
+// schemaType returns the JSON Schema type of a Go type.
+func schemaType(typ string) string {
+	typ = strings.TrimPrefix(typ, "*")
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		return "array"
+	case strings.HasPrefix(typ, "map["):
+		return "object"
+	}
+	switch typ {
+	case "bool":
+		return "boolean"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "integer"
+	case "float32", "float64":
+		return "number"
+	}
+	return "string"
+}
+
+// envSchemas returns a JSON Schema for each JSON env value.
+func envSchemas(structs []docStruct) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			p := strings.Split(f.Key, ".")
+			if len(p) < 2 {
+				continue
+			}
+			schema, ok := schemas[p[0]].(map[string]interface{})
+			if !ok {
+				schema = objectSchema()
+				schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+				schema["title"] = p[0]
+				schemas[p[0]] = schema
+			}
+			for _, k := range p[1 : len(p)-1] {
+				props := schema["properties"].(map[string]interface{})
+				n, ok := props[k].(map[string]interface{})
+				if !ok {
+					n = objectSchema()
+					props[k] = n
+				}
+				schema = n
+			}
+			schema["properties"].(map[string]interface{})[p[len(p)-1]] = f.schema()
+			if f.Required {
+				required, _ := schema["required"].([]string)
+				schema["required"] = append(required, p[len(p)-1])
+			}
+		}
+	}
+	return schemas
+}
+
+func objectSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+// schema returns the JSON Schema of the field value.
+func (f docField) schema() map[string]interface{} {
+	typ := strings.TrimPrefix(f.Type, "*")
+	schema := map[string]interface{}{}
+
+	elem := schema
+	switch schemaType(typ) {
+	case "array":
+		// a JSON array or a string of separated values
+		elem = map[string]interface{}{"type": schemaType(strings.TrimPrefix(typ, "[]"))}
+		schema["type"] = []string{"array", "string"}
+		schema["items"] = elem
+	case "object":
+		schema["type"] = "object"
+	default:
+		schema["type"] = schemaType(typ)
+	}
+
+	if f.Doc != "" {
+		schema["description"] = f.Doc
+	}
+	if f.Default != "" {
+		schema["default"] = f.sample()
+	}
+	if f.OneOf != "" {
+		var enum []interface{}
+		for _, s := range strings.Split(f.OneOf, ",") {
+			enum = append(enum, sampleValue(elem["type"].(string), strings.TrimSpace(s)))
+		}
+		elem["enum"] = enum
+	}
+	if f.Pattern != "" {
+		elem["pattern"] = f.Pattern
+	}
+	switch f.Format {
+	case "url":
+		elem["format"] = "uri"
+	case "hostport":
+		elem["pattern"] = `^[^:]*:[0-9]+$`
+	}
+	bound := func(k, s string) {
+		switch elem["type"] {
+		case "integer", "number":
+			if v, err := strconv.ParseFloat(s, 64); err == nil {
+				elem[k] = v
+			}
+		}
+	}
+	if f.Min != "" {
+		bound("minimum", f.Min)
+	}
+	if f.Max != "" {
+		bound("maximum", f.Max)
+	}
+	if f.Secret {
+		schema["writeOnly"] = true
+	}
+	return schema
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDocSource = `package db
+
+// DBEnv configures the database.
+type DBEnv struct {
+	Name       string     ` + "`env:\"go2_db.name,required\"`" + `
+	Connection connection ` + "`env:\"go2_db.connection\"`" + `
+	Hosts      []string   ` + "`env:\"go2_db.hosts\" envDefault:\"a:1;b:2\" envSeparator:\";\" envFormat:\"hostport\"`" + `
+	Password   string     ` + "`env:\"go2_db.password,secret\"`" + `
+	Port       int        ` + "`env:\"PORT\" envDefault:\"8080\"`" + `
+	Uri        string     ` + "`vcap:\"postgres,uri\"`" + `
+	internal   string
+}
+
+type connection struct {
+	// MaxOpen is the maximum number of open connections.
+	MaxOpen int    ` + "`env:\"max_open\" envMin:\"0\" envMax:\"100\"`" + `
+	Mode    string ` + "`env:\"mode\" envOneOf:\"rw,ro\" envDefault:\"rw\"`" + `
+}
+`
+
+func TestDoc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go2-doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db", "db.go"), []byte(testDocSource), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	structs, err := scanStructs([]string{dir + "/..."})
+	assert.NoError(t, err)
+	assert.Len(t, structs, 1)
+	s := structs[0]
+	assert.Equal(t, "DBEnv", s.Name)
+	assert.Equal(t, "DBEnv configures the database.", s.Doc)
+	assert.Len(t, s.Fields, 7)
+	assert.Equal(t, "go2_db.connection.max_open", s.Fields[1].Key)
+	assert.Equal(t, "Connection.MaxOpen", s.Fields[1].Field)
+	assert.Equal(t, "MaxOpen is the maximum number of open connections.", s.Fields[1].Doc)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeMarkdown(&buf, structs))
+	assert.Contains(t, buf.String(), "| `go2_db.name` | Name | `string` |  | (required) |")
+	assert.Contains(t, buf.String(), "(one of rw, ro)")
+
+	buf.Reset()
+	assert.NoError(t, writeManifest(&buf, "app", structs))
+	assert.Contains(t, buf.String(), `    PORT: "8080"`)
+	assert.Contains(t, buf.String(), `    go2_db: |`)
+
+	values := envValues(structs)
+	assert.Equal(t, map[string]interface{}{
+		"name":     "",
+		"hosts":    []interface{}{"a:1", "b:2"},
+		"password": "",
+		"connection": map[string]interface{}{
+			"max_open": int64(0),
+			"mode":     "rw",
+		},
+	}, values["go2_db"])
+
+	b, err := json.Marshal(envSchemas(structs)["go2_db"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "go2_db",
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string"},
+			"hosts": {"type": ["array", "string"], "items": {"type": "string", "pattern": "^[^:]*:[0-9]+$"}, "default": ["a:1", "b:2"]},
+			"password": {"type": "string", "writeOnly": true},
+			"connection": {
+				"type": "object",
+				"properties": {
+					"max_open": {"type": "integer", "minimum": 0, "maximum": 100, "description": "MaxOpen is the maximum number of open connections."},
+					"mode": {"type": "string", "enum": ["rw", "ro"], "default": "rw"}
+				}
+			}
+		}
+	}`, string(b))
+}
+
+const testPrefixSource = `package store
+
+type BlobEnv struct {
+	Name   string ` + "`env:\"go2_blob.name\"`" + `
+	Bucket string ` + "`env:\",required\" vcap:\"${go2_blob.name},bucket\"`" + `
+}
+
+// StoresEnv configures two blob stores.
+type StoresEnv struct {
+	Archive BlobEnv ` + "`envPrefix:\"go2_blob_archive\"`" + `
+	Cache   BlobEnv ` + "`envPrefix:\"go2_blob_cache\"`" + `
+}
+
+type MirrorEnv struct {
+	Primary BlobEnv ` + "`envPrefix:\"go2_blob_primary\"`" + `
+	Mirror  BlobEnv
+}
+
+type PairEnv struct {
+	Pair MirrorEnv ` + "`envPrefix:\"go2_blob_pair\"`" + `
+}
+
+type mixedEnv struct {
+	Name string ` + "`env:\"go2_blob.name\"`" + `
+	Url  string ` + "`env:\"go2_cdn.url\"`" + `
+}
+
+type MixedEnv struct {
+	Mixed mixedEnv ` + "`envPrefix:\"go2_mixed\"`" + `
+}
+`
+
+func TestDocEnvPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go2-doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "store.go"), []byte(testPrefixSource), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	defer func(w io.Writer) {
+		warnings = w
+	}(warnings)
+	warnings = &buf
+
+	structs, err := scanStructs([]string{dir})
+	assert.NoError(t, err)
+	assert.Len(t, structs, 3)
+	s := structs[0]
+	assert.Equal(t, "StoresEnv", s.Name)
+	assert.Len(t, s.Fields, 4)
+	assert.Equal(t, "go2_blob_archive.name", s.Fields[0].Key)
+	assert.Equal(t, "${go2_blob_archive.name},bucket", s.Fields[1].Vcap)
+	assert.Equal(t, "go2_blob_cache.name", s.Fields[2].Key)
+	assert.Equal(t, "Cache.Bucket", s.Fields[3].Field)
+	assert.Equal(t, "${go2_blob_cache.name},bucket", s.Fields[3].Vcap)
+
+	// the outer envPrefix doesn't rename the keys of an inner struct with its own
+	s = structs[1]
+	assert.Equal(t, "PairEnv", s.Name)
+	assert.Len(t, s.Fields, 4)
+	assert.Equal(t, "go2_blob_primary.name", s.Fields[0].Key)
+	assert.Equal(t, "${go2_blob_primary.name},bucket", s.Fields[1].Vcap)
+	assert.Equal(t, "Pair.Mirror.Name", s.Fields[2].Field)
+	assert.Equal(t, "go2_blob_pair.name", s.Fields[2].Key)
+	assert.Equal(t, "${go2_blob_pair.name},bucket", s.Fields[3].Vcap)
+
+	// the keys of different env names are not merged into one
+	s = structs[2]
+	assert.Equal(t, "MixedEnv", s.Name)
+	assert.Equal(t, "go2_blob.name", s.Fields[0].Key)
+	assert.Equal(t, "go2_cdn.url", s.Fields[1].Key)
+	assert.Contains(t, buf.String(), "store.go:29:2: env prefix go2_mixed can't replace several env names go2_blob, go2_cdn")
+	buf.Reset()
+
+	// nested struct types of other packages are resolved through the imports
+	gopath, err := ioutil.TempDir("", "go2-doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+	for path, src := range map[string]string{
+		"example.com/elastic/elastic.go": testElasticSource,
+		"example.com/search/search.go":   testSearchSource,
+	} {
+		path = filepath.Join(gopath, "src", filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(ctx build.Context, gomod string) {
+		buildContext = ctx
+		os.Setenv("GO111MODULE", gomod)
+	}(buildContext, os.Getenv("GO111MODULE"))
+	buildContext.GOPATH = gopath
+	os.Setenv("GO111MODULE", "off")
+
+	structs, err = scanStructs([]string{filepath.Join(gopath, "src", "example.com", "search")})
+	assert.NoError(t, err)
+	assert.Len(t, structs, 1)
+	s = structs[0]
+	assert.Equal(t, "SearchEnv", s.Name)
+	assert.Len(t, s.Fields, 7)
+	assert.Equal(t, "Logs.Urls", s.Fields[0].Field)
+	assert.Equal(t, "go2_elastic_logs.urls", s.Fields[0].Key)
+	assert.Equal(t, "go2_elastic_logs.sniff.enable", s.Fields[1].Key)
+	assert.Equal(t, "Search.Urls", s.Fields[2].Field)
+	assert.Equal(t, "go2_elastic_search.urls", s.Fields[2].Key)
+	assert.Equal(t, "go2_app", s.Fields[4].Key)
+	assert.Equal(t, "ElasticEnv.Urls", s.Fields[5].Field)
+	assert.Equal(t, "go2_elastic.urls", s.Fields[5].Key)
+
+	// only fields with env or envPrefix tags are reported, with the error loading their package
+	assert.Contains(t, buf.String(), "warning: ")
+	assert.Contains(t, buf.String(), `search.go:11:10: cannot resolve missing.Env: cannot find package "example.com/missing"`)
+	assert.Contains(t, buf.String(), `search.go:13:10: cannot resolve cfenv.App: cannot find package "example.com/go-cfenv"`)
+	assert.NotContains(t, buf.String(), "missing.Client")
+}
+
+const testElasticSource = `package elastic
+
+type ElasticEnv struct {
+	Urls        []string ` + "`env:\"go2_elastic.urls\"`" + `
+	SniffEnable bool     ` + "`env:\"go2_elastic.sniff.enable\"`" + `
+}
+`
+
+const testSearchSource = `package search
+
+import (
+	"example.com/elastic"
+	"example.com/go-cfenv"
+	"example.com/missing"
+)
+
+type SearchEnv struct {
+	Logs    elastic.ElasticEnv  ` + "`envPrefix:\"go2_elastic_logs\"`" + `
+	Missing missing.Env         ` + "`envPrefix:\"go2_missing\"`" + `
+	Search  *elastic.ElasticEnv ` + "`envPrefix:\"go2_elastic_search\"`" + `
+	App     cfenv.App           ` + "`env:\"go2_app\"`" + `
+	Client  missing.Client
+	*elastic.ElasticEnv
+}
+`
@@ -0,0 +1,69 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command go2 provides tools for go2 services.
+//
+// Usage:
+//
+//   go2 config keygen                           generate a key for encrypted config values
+//   go2 config encrypt [-key-file file] [value] encrypt a value as enc:<base64>
+//   go2 config decrypt [-key-file file] [value] decrypt an enc:<base64> value
+//   go2 config doc [-format f] [packages]       document the env tagged config structs
+//
+// The value is read from stdin if not given. Without -key-file the key is read from
+// go2_config_key or the file named by go2_config_key_FILE.
+//
+// The doc command scans the packages, ./... by default, for structs with env tags and
+// writes a Markdown reference (-format markdown), a sample manifest.yml env block
+// (-format manifest) or a JSON Schema for each JSON env value (-format schema).
+// Nested struct types of other packages are looked up like the go tool does,
+// env and envPrefix tagged fields whose package can't be loaded are reported as warnings, e.g.
+//
+//   go2 config doc ./... > CONFIG.md
+//   go2 config doc -format schema -dir schemas ./cf/...
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var configCommands = []command{
+	{"keygen", "generate a key for encrypted config values", keygen},
+	{"encrypt", "encrypt a value as enc:<base64>", encrypt},
+	{"decrypt", "decrypt an enc:<base64> value", decrypt},
+	{"doc", "document the env tagged config structs", doc},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: go2 config <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range configCommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "config" {
+		usage()
+	}
+
+	for _, c := range configCommands {
+		if c.name == os.Args[2] {
+			if err := c.run(os.Args[3:]); err != nil {
+				fmt.Fprintf(os.Stderr, "go2 config %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
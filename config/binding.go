@@ -0,0 +1,139 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+// Kubernetes service bindings (https://servicebinding.io) are read from
+// $SERVICE_BINDING_ROOT along with the services in VCAP_SERVICES, so that
+// GetService and ServiceUri work on both Cloud Foundry and Kubernetes:
+//
+//   $SERVICE_BINDING_ROOT/
+//     my-postgres/
+//       type       -> postgresql
+//       provider   -> bitnami
+//       host
+//       port
+//       username
+//       password
+//       database
+//
+// Each binding becomes a service named after its directory, labeled with its type and
+// tagged with its type and provider. The files are its credentials. If the binding has
+// no uri, one is composed from host, port, username, password and database for known types.
+
+const serviceBindingRoot = "SERVICE_BINDING_ROOT"
+
+// bindingSchemes maps binding types to the uri schemes of composed uris.
+var bindingSchemes = map[string]string{
+	"postgresql": "postgres",
+	"mysql":      "mysql",
+	"rabbitmq":   "amqp",
+	"redis":      "redis",
+	"mongodb":    "mongodb",
+}
+
+// readBindings returns the services bound under root, keyed by label,
+// and the errors reading them. Bindings that cannot be read are skipped.
+func readBindings(root string) (cfenv.Services, []error) {
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, []error{fmt.Errorf("%s: %v", serviceBindingRoot, err)}
+	}
+
+	var errs []error
+	services := cfenv.Services{}
+	for _, d := range dirs {
+		if strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+
+		s, err := readBinding(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Service binding %s: %v", d.Name(), err))
+			continue
+		}
+		services[s.Label] = append(services[s.Label], s)
+	}
+	return services, errs
+}
+
+func readBinding(dir string) (cfenv.Service, error) {
+	s := cfenv.Service{
+		Name:        filepath.Base(dir),
+		Credentials: make(map[string]interface{}),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return s, err
+	}
+	for _, f := range files {
+		// entries are usually symlinks maintained by kubernetes, e.g. ..data/password
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return s, err
+		}
+		s.Credentials[f.Name()] = strings.TrimSpace(string(b))
+	}
+
+	s.Label, _ = s.Credentials["type"].(string)
+	if s.Label != "" {
+		s.Tags = append(s.Tags, s.Label)
+	}
+	if provider, _ := s.Credentials["provider"].(string); provider != "" {
+		s.Tags = append(s.Tags, provider)
+	}
+	if _, ok := s.Credentials["uri"]; !ok {
+		if uri := bindingUri(s); uri != "" {
+			s.Credentials["uri"] = uri
+		}
+	}
+	return s, nil
+}
+
+// bindingUri composes a uri from the well known credentials of a binding.
+func bindingUri(s cfenv.Service) string {
+	scheme, ok := bindingSchemes[s.Label]
+	host, _ := s.Credentials["host"].(string)
+	if !ok || host == "" {
+		return ""
+	}
+
+	u := url.URL{Scheme: scheme, Host: host}
+	if port, _ := s.Credentials["port"].(string); port != "" {
+		u.Host += ":" + port
+	}
+	if username, _ := s.Credentials["username"].(string); username != "" {
+		if password, ok := s.Credentials["password"].(string); ok {
+			u.User = url.UserPassword(username, password)
+		} else {
+			u.User = url.User(username)
+		}
+	}
+	if database, _ := s.Credentials["database"].(string); database != "" {
+		u.Path = "/" + database
+	}
+	return u.String()
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Values of the form enc:<base64> are encrypted with AES-GCM and decrypted by Settings
+// with the base64 encoded 128, 192 or 256 bit key in go2_config_key, or in the file
+// named by go2_config_key_FILE, e.g.
+//
+//   go2_config_key_FILE=/etc/secrets/go2-key
+//   go2_newrelic={
+//     "enable": true,
+//     "license": "enc:2jEtBYLZ..."
+//   }
+//
+// Decrypted values are treated as secret. Use the go2 command to generate keys
+// and encrypt values:
+//
+//   go2 config keygen > key
+//   go2 config encrypt -key-file key "__YOUR_NEW_RELIC_LICENSE_KEY__"
+
+// go2_config_key holds the key for decrypting values.
+const go2_config_key = "go2_config_key"
+
+// encPrefix marks encrypted values.
+const encPrefix = "enc:"
+
+var (
+	// ErrNoKey is returned when encrypted values are found but no key is configured.
+	ErrNoKey = errors.New("Encrypted value found but " + go2_config_key + " is not set")
+)
+
+// GenerateKey returns a new random 256 bit key, base64 encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key: %v", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("Invalid key size %d, expected 16, 24 or 32 bytes", len(key))
+}
+
+// Encrypt encrypts plaintext with key and returns it as enc:<base64>.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	b := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Decrypt decrypts a value of the form enc:<base64> with key.
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("Value is not encrypted")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < gcm.NonceSize() {
+		return "", errors.New("Encrypted value is too short")
+	}
+	plaintext, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value is of the form enc:<base64>.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encPrefix)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionKey returns the key in go2_config_key, or in the file named by go2_config_key_FILE.
+func (r *Settings) EncryptionKey() ([]byte, error) {
+	t := r.readEnv(go2_config_key)
+	if t.err != nil {
+		return nil, t.err
+	}
+	s := toString(scalar(t.value))
+	if s == "" {
+		return nil, ErrNoKey
+	}
+	return ParseKey(s)
+}
+
+// decryptNode decrypts the encrypted string leaves of a JSON value. The node is copied,
+// values held by sources are not modified. The dotted paths of the decrypted leaves,
+// "" for node itself, are added to secrets along with decryption errors, if any.
+func (r *Settings) decryptNode(node interface{}, path string, secrets map[string]error) interface{} {
+	switch t := node.(type) {
+	case string:
+		if !IsEncrypted(t) {
+			return t
+		}
+		key, err := r.EncryptionKey()
+		if err != nil {
+			secrets[path] = err
+			return t
+		}
+		s, err := Decrypt(key, t)
+		if err != nil {
+			secrets[path] = fmt.Errorf("Decrypt: %v", err)
+			return t
+		}
+		secrets[path] = nil
+		return s
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = r.decryptNode(v, joinKey(path, k), secrets)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = r.decryptNode(v, joinKey(path, strconv.Itoa(i)), secrets)
+		}
+		return a
+	}
+	return node
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	k, err := GenerateKey()
+	assert.NoError(t, err)
+	key, err := ParseKey(k)
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	enc, err := Encrypt(key, "license")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(enc))
+
+	dec, err := Decrypt(key, enc)
+	assert.NoError(t, err)
+	assert.Equal(t, "license", dec)
+
+	other, _ := GenerateKey()
+	otherKey, _ := ParseKey(other)
+	_, err = Decrypt(otherKey, enc)
+	assert.Error(t, err)
+
+	_, err = ParseKey("c2hvcnQ=")
+	assert.Error(t, err)
+}
+
+func TestEncryptedValues(t *testing.T) {
+	k, _ := GenerateKey()
+	key, _ := ParseKey(k)
+	license, _ := Encrypt(key, "abc123")
+	password, _ := Encrypt(key, "s3cret")
+
+	dir := writeFiles(t, map[string]string{"key": k + "\n"})
+	defer os.RemoveAll(dir)
+
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"go2_config_key_FILE": filepath.Join(dir, "key"),
+		"go2_newrelic":        `{"enable": true, "license": "` + license + `"}`,
+		"PASSWORD":            password,
+		"BROKEN":              "enc:AAAA",
+	}))
+
+	assert.Equal(t, "abc123", s.GetStringEnv("go2_newrelic", "license"))
+	assert.Equal(t, "s3cret", s.GetStringEnv("PASSWORD"))
+
+	type config struct {
+		Enable   bool   `env:"go2_newrelic.enable"`
+		License  string `env:"go2_newrelic.license"`
+		Password string `env:"PASSWORD"`
+	}
+	desc, err := s.Describe(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", desc[0].Value)
+	assert.False(t, desc[0].Secret)
+	assert.Equal(t, maskedValue, desc[1].Value)
+	assert.True(t, desc[2].Secret)
+
+	type broken struct {
+		Broken string `env:"BROKEN"`
+	}
+	assert.Error(t, s.Parse(&broken{}))
+
+	noKey := NewSettings(NewMapSource("test", map[string]interface{}{
+		"PASSWORD": password,
+	}))
+	err = noKey.Parse(&config{})
+	assert.Error(t, err)
+	assert.Equal(t, ErrNoKey, err.(*ParseError).Errors[0].Err)
+}
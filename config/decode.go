@@ -0,0 +1,195 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParserFunc parses the string value of an env variable into a value
+// of the type it is registered for.
+type ParserFunc func(value string) (interface{}, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[reflect.Type]ParserFunc{
+		durationType: func(s string) (interface{}, error) {
+			return time.ParseDuration(s)
+		},
+		reflect.TypeOf(url.URL{}): func(s string) (interface{}, error) {
+			u, err := url.Parse(s)
+			if err != nil {
+				return nil, err
+			}
+			return *u, nil
+		},
+		reflect.TypeOf((*regexp.Regexp)(nil)): func(s string) (interface{}, error) {
+			return regexp.Compile(s)
+		},
+		reflect.TypeOf(ByteSize(0)): func(s string) (interface{}, error) {
+			return ParseByteSize(s)
+		},
+	}
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// RegisterParser registers fn for struct fields of type t, e.g.
+//
+//   config.RegisterParser(reflect.TypeOf(logrus.Level(0)), func(s string) (interface{}, error) {
+//       return logrus.ParseLevel(s)
+//   })
+//
+// Registered parsers take precedence over encoding.TextUnmarshaler and json.Unmarshaler
+// implemented by the type. Parsers for time.Duration, url.URL, *regexp.Regexp and ByteSize
+// are registered by default, pointers to registered types are handled as well.
+func RegisterParser(t reflect.Type, fn ParserFunc) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[t] = fn
+}
+
+func parserFor(t reflect.Type) ParserFunc {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	return parsers[t]
+}
+
+// decodable reports whether values of type t are decoded as a whole by
+// a registered parser or the unmarshaler interfaces rather than by kind.
+func decodable(t reflect.Type) bool {
+	if parserFor(t) != nil {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(textUnmarshalerType) || pt.Implements(jsonUnmarshalerType) {
+		return true
+	}
+	return t.Kind() == reflect.Ptr && decodable(t.Elem())
+}
+
+// decode sets field from value if the field type is decodable.
+// It reports false if the field has to be set by its kind.
+func decode(field reflect.Value, value string) (bool, error) {
+	if !decodable(field.Type()) {
+		return false, nil
+	}
+	v, err := decodeValue(field.Type(), value)
+	if err != nil {
+		return true, err
+	}
+	field.Set(v)
+	return true, nil
+}
+
+func decodeValue(t reflect.Type, value string) (reflect.Value, error) {
+	if fn := parserFor(t); fn != nil {
+		i, err := fn(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.ValueOf(i)
+		if !v.IsValid() || !v.Type().ConvertibleTo(t) {
+			return reflect.Value{}, fmt.Errorf("Parser for %v returned %T", t, i)
+		}
+		return v.Convert(t), nil
+	}
+
+	pv := reflect.New(t)
+	switch u := pv.Interface().(type) {
+	case encoding.TextUnmarshaler:
+		if err := u.UnmarshalText([]byte(value)); err != nil {
+			return reflect.Value{}, err
+		}
+		return pv.Elem(), nil
+	case json.Unmarshaler:
+		var raw json.RawMessage
+		data := []byte(value)
+		if err := json.Unmarshal(data, &raw); err != nil {
+			data = []byte(strconv.Quote(value))
+		}
+		if err := u.UnmarshalJSON(data); err != nil {
+			return reflect.Value{}, err
+		}
+		return pv.Elem(), nil
+	}
+
+	if t.Kind() == reflect.Ptr {
+		v, err := decodeValue(t.Elem(), value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		pv = reflect.New(t.Elem())
+		pv.Elem().Set(v)
+		return pv, nil
+	}
+	return reflect.Value{}, ErrUnsupportedType
+}
+
+// ByteSize is a size in bytes that can be configured with a unit suffix,
+// e.g. "512", "64KB", "10MB" or "1.5GiB".
+// KB, MB, GB and TB are treated as their binary counterparts KiB, MiB, GiB and TiB.
+type ByteSize uint64
+
+const (
+	_           = iota
+	KB ByteSize = 1 << (10 * iota)
+	MB
+	GB
+	TB
+)
+
+var byteUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"TIB", TB}, {"GIB", GB}, {"MIB", MB}, {"KIB", KB},
+	{"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB},
+	{"T", TB}, {"G", GB}, {"M", MB}, {"K", KB},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "10MB" into a ByteSize.
+func ParseByteSize(s string) (ByteSize, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	unit := ByteSize(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 || math.IsNaN(n) {
+		return 0, fmt.Errorf("Invalid byte size %q", s)
+	}
+	// float64(math.MaxUint64) rounds up to 1<<64
+	if n*float64(unit) >= math.MaxUint64 {
+		return 0, fmt.Errorf("Byte size %q out of range", s)
+	}
+	return ByteSize(n * float64(unit)), nil
+}
+
+func (b ByteSize) String() string {
+	for _, u := range byteUnits[4:8] {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatUint(uint64(b/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
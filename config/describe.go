@@ -0,0 +1,116 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+// SourceDefault is the source of values taken from the envDefault tag.
+const SourceDefault = "default"
+
+// FieldInfo describes where the value of a struct field came from.
+type FieldInfo struct {
+	Field  string `json:"field"`            // name of the struct field, dotted for nested structs
+	Key    string `json:"key"`              // env key of the field
+	Value  string `json:"value"`            // final value, masked if the field is secret
+	Source string `json:"source"`           // e.g. "env", "file:config.yaml" or "default", empty if not set
+	Secret bool   `json:"secret,omitempty"` // whether the field is secret
+}
+
+// Description lists the fields of a struct as loaded by Parse.
+type Description []FieldInfo
+
+// Describe loads a new value of the struct type v points to, as Parse would,
+// and describes the value and source of each field. v itself is not modified.
+// Fields that failed to load are left out and reported by the returned error.
+//
+//   desc, err := config.AppSettings().Describe(&postgres.PostgresEnv{})
+//   desc.WriteTable(os.Stdout)
+func (r *Settings) Describe(v interface{}) (Description, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, ErrNotAStructPtr
+	}
+
+	p := &parser{settings: r}
+	p.doParse(reflect.New(t.Elem()).Elem(), "", "")
+	if len(p.errs) > 0 {
+		return p.fields, &ParseError{Errors: p.errs}
+	}
+	return p.fields, nil
+}
+
+// Describe describes v as loaded from the sources of AppSettings.
+func Describe(v interface{}) (Description, error) {
+	return settings.Describe(v)
+}
+
+// WriteTable writes the description as an aligned text table.
+func (d Description) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tKEY\tVALUE\tSOURCE")
+	for _, f := range d {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Field, f.Key, f.Value, f.Source)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the description as an indented JSON array.
+func (d Description) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// describeValue returns the value of the field as shown in descriptions.
+func describeValue(field reflect.Value, secret bool) string {
+	for field.Kind() == reflect.Ptr && !decodable(field.Type()) {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if field.IsNil() {
+			return ""
+		}
+	}
+
+	v := field.Interface()
+	if field.CanAddr() {
+		if _, ok := v.(fmt.Stringer); !ok {
+			v = field.Addr().Interface()
+		}
+	}
+
+	var s string
+	switch t := v.(type) {
+	case fmt.Stringer:
+		s = t.String()
+	default:
+		switch field.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Struct:
+			b, _ := json.Marshal(field.Interface())
+			s = string(b)
+		default:
+			s = fmt.Sprintf("%v", field.Interface())
+		}
+	}
+
+	if secret && s != "" {
+		return maskedValue
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	s := NewSettings(
+		NewMapSource("overrides", map[string]interface{}{
+			"go2_test": map[string]interface{}{"name": "db", "password": "s3cret"},
+		}),
+		NewMapSource("vcap", map[string]interface{}{
+			"PORT": "8080",
+		}),
+	)
+
+	type config struct {
+		Name     string        `env:"go2_test.name"`
+		Password string        `env:"go2_test.password,secret"`
+		Port     int           `env:"PORT"`
+		Timeout  time.Duration `env:"TIMEOUT" envDefault:"5s"`
+		Urls     []string      `env:"URLS"`
+		Missing  string        `env:"go2_test.missing"`
+	}
+
+	cfg := &config{}
+	desc, err := s.Describe(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config{}, *cfg)
+	assert.Equal(t, Description{
+		{Field: "Name", Key: "go2_test.name", Value: "db", Source: "overrides"},
+		{Field: "Password", Key: "go2_test.password", Value: "***", Source: "overrides", Secret: true},
+		{Field: "Port", Key: "PORT", Value: "8080", Source: "vcap"},
+		{Field: "Timeout", Key: "TIMEOUT", Value: "5s", Source: "default"},
+		{Field: "Urls", Key: "URLS", Value: "", Source: ""},
+		{Field: "Missing", Key: "go2_test.missing", Value: "", Source: ""},
+	}, desc)
+
+	var buf bytes.Buffer
+	assert.NoError(t, desc.WriteTable(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), "FIELD"))
+	assert.NotContains(t, buf.String(), "s3cret")
+
+	buf.Reset()
+	assert.NoError(t, desc.WriteJSON(&buf))
+	var infos []FieldInfo
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &infos))
+	assert.Len(t, infos, 6)
+
+	_, err = s.Describe(*cfg)
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
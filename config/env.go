@@ -5,25 +5,37 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func osGetenv(key string) string {
-	p := strings.Split(key, ".")
-	if len(p) == 1 {
-		return settings.GetStringEnv(p[0])
-	}
-	return settings.GetStringEnv(p[0], p[1:]...)
+// osGetenv returns the value of the dotted key as a string or, if the value
+// is a JSON object or array, as the JSON node so that it can be decoded
+// into map, slice and struct fields.
+func (p *parser) osGetenv(key string) envValue {
+	k := strings.Split(key, ".")
+	t := p.settings.lookupKey(k[0], k[1:]...)
+	t.value = scalar(t.value)
+	return t
 }
 
+// Parse parses a struct containing `env` tags and loads its values from
+// the sources of AppSettings. Fields with `vcap` tags are loaded from the
+// credentials of bound services, see Service.
 func Parse(v interface{}) error {
 	return parse(v)
 }
 
+func parse(v interface{}) error {
+	return parseWith(settings, v)
+}
+
 var (
 	// ErrNotAStructPtr is returned if you pass something that is not a pointer to a
 	// Struct to Parse
@@ -33,17 +45,12 @@ var (
 	// ErrUnsupportedSliceType if the slice element type is not supported by env
 	ErrUnsupportedSliceType = errors.New("Unsupported slice type")
 	// Friendly names for reflect types
-	sliceOfInts = reflect.TypeOf([]int(nil))
-	sliceOfInt64s = reflect.TypeOf([]int64(nil))
-	sliceOfStrings = reflect.TypeOf([]string(nil))
-	sliceOfBools = reflect.TypeOf([]bool(nil))
-	sliceOfFloat32s = reflect.TypeOf([]float32(nil))
-	sliceOfFloat64s = reflect.TypeOf([]float64(nil))
+	durationType = reflect.TypeOf(time.Duration(0))
 )
 
-// Parse parses a struct containing `env` tags and loads its values from
-// environment variables.
-func parse(v interface{}) error {
+// parseWith parses a struct containing `env` tags and loads its values from
+// the sources of settings.
+func parseWith(settings *Settings, v interface{}) error {
 	ptrRef := reflect.ValueOf(v)
 	if ptrRef.Kind() != reflect.Ptr {
 		return ErrNotAStructPtr
@@ -52,52 +59,365 @@ func parse(v interface{}) error {
 	if ref.Kind() != reflect.Struct {
 		return ErrNotAStructPtr
 	}
-	return doParse(ref)
+
+	p := &parser{settings: settings}
+	p.doParse(ref, "", "")
+	if len(p.errs) > 0 {
+		return &ParseError{Errors: p.errs}
+	}
+	return nil
+}
+
+// parser collects the field errors of a single parse so that
+// all of them can be reported at once, as well as where the value
+// of each field came from.
+type parser struct {
+	settings *Settings
+	errs     []*FieldError
+	fields   []FieldInfo
+	renames  []envRename // of the enclosing envPrefix fields, innermost last
 }
 
-func doParse(ref reflect.Value) error {
+// fieldValue is the resolved value of a struct field.
+type fieldValue struct {
+	key    string      // env key
+	value  interface{} // string or JSON node, see osGetenv
+	source string      // source of the value, "" if not set
+	secret bool
+}
+
+func (p *parser) fail(name string, fv fieldValue, err error) {
+	value := toString(fv.value)
+	if fv.secret && value != "" {
+		value = maskedValue
+	}
+	p.errs = append(p.errs, &FieldError{
+		Field: name,
+		Key:   fv.key,
+		Value: value,
+		Err:   err,
+	})
+}
+
+// valueError returns the conversion or validation error of a field, or errInvalidSecret
+// for secret fields since causes such as strconv errors quote or escape the value.
+func valueError(fv fieldValue, err error) error {
+	if fv.secret {
+		return errInvalidSecret
+	}
+	return err
+}
+
+func (p *parser) record(name string, fv fieldValue, field reflect.Value) {
+	p.fields = append(p.fields, FieldInfo{
+		Field:  name,
+		Key:    fv.key,
+		Value:  describeValue(field, fv.secret),
+		Source: fv.source,
+		Secret: fv.secret,
+	})
+}
+
+// doParse walks the fields of ref. Nested struct fields are parsed recursively,
+// their env tag (if any) is joined with prefix and used as the key prefix
+// for the fields of the nested struct, e.g.
+//
+//   type PostgresEnv struct {
+//       Connection struct {
+//           MaxOpen int `env:"max_open"`
+//       } `env:"go2_postgres.connection"`
+//   }
+//
+// resolves MaxOpen from go2_postgres.connection.max_open
+//
+// An envPrefix tag replaces the env name of the keys of the nested struct
+// so that a struct type can be reused for several env values, e.g.
+//
+//   type SearchEnv struct {
+//       Logs   elastic.ElasticEnv `envPrefix:"go2_elastic_logs"`
+//       Search elastic.ElasticEnv `envPrefix:"go2_elastic_search"`
+//   }
+//
+// resolves Logs.Urls from go2_elastic_logs.urls and Search.Urls from go2_elastic_search.urls
+// instead of go2_elastic.urls. References to the env name in vcap tags, e.g.
+// ${go2_blobstore.name}, are replaced as well. A nested struct with its own envPrefix
+// is renamed by that prefix only. The keys renamed by an envPrefix must share one env name.
+func (p *parser) doParse(ref reflect.Value, prefix, path string) {
 	refType := ref.Type()
 	for i := 0; i < refType.NumField(); i++ {
-		value, err := get(refType.Field(i))
+		field := ref.Field(i)
+		structField := refType.Field(i)
+		if structField.PkgPath != "" && !structField.Anonymous {
+			continue // unexported
+		}
+		name := joinKey(path, structField.Name)
+		if isNested(field.Type()) {
+			p.parseNested(field, structField, prefix, name)
+			continue
+		}
+		fv, err := p.get(structField, prefix)
 		if err != nil {
-			return err
+			p.fail(name, fv, err)
+			continue
+		}
+		if fv.value != "" {
+			if err := setValue(field, structField, fv.value); err != nil {
+				p.fail(name, fv, valueError(fv, err))
+				continue
+			}
 		}
-		if value == "" {
+		if err := validate(field, structField, fv.value != ""); err != nil {
+			p.fail(name, fv, valueError(fv, err))
 			continue
 		}
-		if err := set(ref.Field(i), refType.Field(i), value); err != nil {
-			return err
+		p.record(name, fv, field)
+	}
+}
+
+// isNested reports whether the field is a struct or pointer to struct
+// with env tags whose fields should be parsed recursively.
+// Structs without env tags are decoded from JSON values like any other field.
+func isNested(t reflect.Type) bool {
+	if decodable(t) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && hasEnvTags(t, nil)
+}
+
+// hasEnvTags reports whether t has fields with env, vcap or envPrefix tags,
+// directly or in nested structs.
+func hasEnvTags(t reflect.Type, seen []reflect.Type) bool {
+	for _, s := range seen {
+		if s == t {
+			return false
 		}
 	}
-	return nil
+	seen = append(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		for _, tag := range []string{"env", "vcap", "envPrefix"} {
+			if _, ok := f.Tag.Lookup(tag); ok {
+				return true
+			}
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !decodable(f.Type) && hasEnvTags(ft, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseNested(field reflect.Value, structField reflect.StructField, prefix, path string) {
+	key, _ := parseKeyForOption(structField.Tag.Get("env"))
+	prefix = joinKey(prefix, key)
+
+	if envPrefix := structField.Tag.Get("envPrefix"); envPrefix != "" {
+		r, err := newEnvRename(field.Type(), prefix, envPrefix)
+		if err != nil {
+			p.fail(path, fieldValue{}, err)
+			return
+		}
+		p.renames = append(p.renames, r)
+		defer func() {
+			p.renames = p.renames[:len(p.renames)-1]
+		}()
+	}
+
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if !field.CanSet() {
+				return
+			}
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	p.doParse(field, prefix, path)
+}
+
+// joinKey composes a dotted key from the parent prefix and the key of the field.
+func joinKey(prefix, key string) string {
+	switch {
+	case prefix == "":
+		return key
+	case key == "":
+		return prefix
+	}
+	return prefix + "." + key
 }
 
-func get(field reflect.StructField) (string, error) {
-	var (
-		val string
-		err error
-	)
+// envRename maps the env name of the keys of a nested struct to its envPrefix.
+type envRename struct {
+	names     map[string]bool
+	envPrefix string
+}
+
+// newEnvRename returns the envRename of the nested struct type t whose keys are joined with prefix.
+// The keys must have a single env name, several would be merged into the one envPrefix.
+func newEnvRename(t reflect.Type, prefix, envPrefix string) (envRename, error) {
+	r := envRename{names: make(map[string]bool), envPrefix: envPrefix}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	r.collect(t, prefix, nil)
+	if len(r.names) > 1 {
+		var names []string
+		for name := range r.names {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return r, errors.New("Env prefix " + envPrefix + " can't replace several env names " + strings.Join(names, ", "))
+	}
+	return r, nil
+}
+
+func (r envRename) collect(t reflect.Type, prefix string, seen []reflect.Type) {
+	for _, s := range seen {
+		if s == t {
+			return
+		}
+	}
+	seen = append(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		key, _ := parseKeyForOption(f.Tag.Get("env"))
+		if isNested(f.Type) {
+			if f.Tag.Get("envPrefix") != "" {
+				// the keys of the inner struct are renamed by its own envPrefix only
+				continue
+			}
+			nt := f.Type
+			if nt.Kind() == reflect.Ptr {
+				nt = nt.Elem()
+			}
+			r.collect(nt, joinKey(prefix, key), seen)
+			continue
+		}
+		if key != "" {
+			r.names[envName(joinKey(prefix, key))] = true
+		}
+	}
+}
+
+// key replaces the env name of the dotted key.
+func (r envRename) key(key string) string {
+	name := envName(key)
+	if !r.names[name] {
+		return key
+	}
+	return r.envPrefix + key[len(name):]
+}
+
+// refs replaces the env names of the ${...} references in a vcap tag.
+func (r envRename) refs(tag string) string {
+	for name := range r.names {
+		tag = strings.Replace(tag, "${"+name+".", "${"+r.envPrefix+".", -1)
+		tag = strings.Replace(tag, "${"+name+"}", "${"+r.envPrefix+"}", -1)
+	}
+	return tag
+}
+
+// envName returns the env name of a dotted key, e.g. go2_elastic of go2_elastic.urls.
+func envName(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// renameKey applies the rename of the innermost enclosing envPrefix field to key.
+func renameKey(renames []envRename, key string) string {
+	if len(renames) == 0 {
+		return key
+	}
+	return renames[len(renames)-1].key(key)
+}
+
+// renameRefs applies the rename of the innermost enclosing envPrefix field to a vcap tag.
+func renameRefs(renames []envRename, tag string) string {
+	if len(renames) == 0 {
+		return tag
+	}
+	return renames[len(renames)-1].refs(tag)
+}
 
+// get resolves the env key of the field, its value and source and whether it is secret.
+func (p *parser) get(field reflect.StructField, prefix string) (fv fieldValue, err error) {
 	key, opts := parseKeyForOption(field.Tag.Get("env"))
+	if key != "" {
+		key = renameKey(p.renames, joinKey(prefix, key))
+	}
+	fv.key = key
+
+	var required, file bool
+	for _, opt := range opts {
+		switch opt {
+		case "":
+			break
+		case "required":
+			required = true
+		case "secret":
+			fv.secret = true
+		case "nonempty":
+			// checked by validate
+		case "file":
+			// the value is the path of a file holding the secret
+			file, fv.secret = true, true
+		default:
+			return fv, errors.New("Env tag option " + opt + " not supported.")
+		}
+	}
+
+	// fields with only a vcap tag have no env key to look up
+	fv.value = ""
+	if key != "" {
+		t, ok := p.settings.lookupFlag(key)
+		if !ok {
+			t = p.osGetenv(key)
+		}
+		fv.value, fv.source, fv.secret = t.value, t.source, fv.secret || t.secret
+		if t.err != nil {
+			return fv, t.err
+		}
+	}
+
+	vcap := renameRefs(p.renames, field.Tag.Get("vcap"))
+	if fv.value == "" && vcap != "" {
+		if key == "" {
+			fv.key = sourceVcap + vcap
+		}
+		if fv.value, fv.source, err = p.credential(vcap); err != nil {
+			return fv, err
+		}
+	}
 
-	defaultValue := field.Tag.Get("envDefault")
-	val = getOr(key, defaultValue)
-
-	if len(opts) > 0 {
-		for _, opt := range opts {
-			// The only option supported is "required".
-			switch opt {
-			case "":
-				break
-			case "required":
-				val, err = getRequired(key)
-			default:
-				err = errors.New("Env tag option " + opt + " not supported.")
+	if fv.value == "" {
+		if required {
+			if key == "" && vcap != "" {
+				return fv, errors.New("Required service credential " + vcap + " is not bound")
 			}
+			return fv, errors.New("Required environment variable " + key + " is not set")
 		}
+		if defaultValue := field.Tag.Get("envDefault"); defaultValue != "" {
+			fv.value, fv.source = defaultValue, SourceDefault
+		}
+	}
+
+	if path, ok := fv.value.(string); ok && file && path != "" {
+		fv.value, err = readSecretFile(path)
+		fv.source = sourceSecretFile + path
 	}
 
-	return val, err
+	return fv, err
 }
 
 // split the env tag's key into the expected key and desired option, if any.
@@ -106,27 +426,96 @@ func parseKeyForOption(key string) (string, []string) {
 	return opts[0], opts[1:]
 }
 
-func getRequired(key string) (string, error) {
-	if value := osGetenv(key); value != "" {
-		return value, nil
+// toString returns the value as reported in errors, JSON values are marshaled.
+func toString(value interface{}) string {
+	switch s := value.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
 	}
-	// We do not use fmt.Errorf to avoid another import.
-	return "", errors.New("Required environment variable " + key + " is not set")
+	b, _ := json.Marshal(value)
+	return string(b)
 }
 
-func getOr(key, defaultValue string) string {
-	value := osGetenv(key)
-	if value != "" {
-		return value
+// setValue sets the field from a string or a JSON node.
+func setValue(field reflect.Value, refType reflect.StructField, value interface{}) error {
+	if s, ok := value.(string); ok {
+		return set(field, refType, s)
 	}
-	return defaultValue
+	return setJSON(field, refType, value)
+}
+
+// setJSON decodes a JSON object or array into the field. Slices and maps are
+// set element by element so that scalar elements are parsed like env values,
+// e.g. ["1s", "2m"] for []time.Duration, everything else is decoded with encoding/json.
+func setJSON(field reflect.Value, refType reflect.StructField, node interface{}) error {
+	t := field.Type()
+	switch n := node.(type) {
+	case []interface{}:
+		if t.Kind() != reflect.Slice || decodable(t) {
+			break
+		}
+		s := reflect.MakeSlice(t, len(n), len(n))
+		for i, e := range n {
+			if err := setValue(s.Index(i), refType, scalar(e)); err != nil {
+				return err
+			}
+		}
+		field.Set(s)
+		return nil
+	case map[string]interface{}:
+		if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String || decodable(t) {
+			break
+		}
+		m := reflect.MakeMap(t)
+		for k, e := range n {
+			v := reflect.New(t.Elem()).Elem()
+			if err := setValue(v, refType, scalar(e)); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), v)
+		}
+		field.Set(m)
+		return nil
+	}
+
+	b, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, field.Addr().Interface())
+}
+
+// scalar returns JSON objects and arrays as is and the string form of anything else.
+func scalar(node interface{}) interface{} {
+	switch t := node.(type) {
+	case map[string]interface{}, []interface{}:
+		return t
+	case string:
+		return t
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", node)
 }
 
 func set(field reflect.Value, refType reflect.StructField, value string) error {
+	if ok, err := decode(field, value); ok {
+		return err
+	}
+
 	switch field.Kind() {
+	case reflect.Ptr:
+		// pointers distinguish unset values from zero values
+		v := reflect.New(field.Type().Elem())
+		if err := set(v.Elem(), refType, value); err != nil {
+			return err
+		}
+		field.Set(v)
 	case reflect.Slice:
 		separator := refType.Tag.Get("envSeparator")
-		return handleSlice(field, value, separator)
+		return handleSlice(field, refType, value, separator)
 	case reflect.String:
 		field.SetString(value)
 	case reflect.Bool:
@@ -135,153 +524,46 @@ func set(field reflect.Value, refType reflect.StructField, value string) error {
 			return err
 		}
 		field.SetBool(bvalue)
-	case reflect.Int:
-		intValue, err := strconv.ParseInt(value, 10, 32)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, field.Type().Bits())
 		if err != nil {
 			return err
 		}
 		field.SetInt(intValue)
-	case reflect.Float32:
-		v, err := strconv.ParseFloat(value, 32)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(value, 10, field.Type().Bits())
 		if err != nil {
 			return err
 		}
-		field.SetFloat(v)
-	case reflect.Float64:
-		v, err := strconv.ParseFloat(value, 64)
+		field.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, field.Type().Bits())
 		if err != nil {
 			return err
 		}
-		field.Set(reflect.ValueOf(v))
-	case reflect.Int64:
-		if refType.Type.String() == "time.Duration" {
-			dValue, err := time.ParseDuration(value)
-			if err != nil {
-				return err
-			}
-			field.Set(reflect.ValueOf(dValue))
-		} else {
-			intValue, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return err
-			}
-			field.SetInt(intValue)
-		}
+		field.SetFloat(v)
 	default:
 		return ErrUnsupportedType
 	}
 	return nil
 }
 
-func handleSlice(field reflect.Value, value, separator string) error {
+func handleSlice(field reflect.Value, refType reflect.StructField, value, separator string) error {
 	if separator == "" {
 		separator = ","
 	}
 
 	splitData := strings.Split(value, separator)
 
-	switch field.Type() {
-	case sliceOfStrings:
-		field.Set(reflect.ValueOf(splitData))
-	case sliceOfInts:
-		intData, err := parseInts(splitData)
-		if err != nil {
-			return err
-		}
-		field.Set(reflect.ValueOf(intData))
-	case sliceOfInt64s:
-		int64Data, err := parseInt64s(splitData)
-		if err != nil {
-			return err
-		}
-		field.Set(reflect.ValueOf(int64Data))
-
-	case sliceOfFloat32s:
-		data, err := parseFloat32s(splitData)
-		if err != nil {
-			return err
-		}
-		field.Set(reflect.ValueOf(data))
-	case sliceOfFloat64s:
-		data, err := parseFloat64s(splitData)
-		if err != nil {
-			return err
-		}
-		field.Set(reflect.ValueOf(data))
-	case sliceOfBools:
-		boolData, err := parseBools(splitData)
-		if err != nil {
+	s := reflect.MakeSlice(field.Type(), len(splitData), len(splitData))
+	for i, v := range splitData {
+		if err := set(s.Index(i), refType, v); err != nil {
+			if err == ErrUnsupportedType {
+				return ErrUnsupportedSliceType
+			}
 			return err
 		}
-		field.Set(reflect.ValueOf(boolData))
-	default:
-		return ErrUnsupportedSliceType
 	}
+	field.Set(s)
 	return nil
 }
-
-func parseInts(data []string) ([]int, error) {
-	var intSlice []int
-
-	for _, v := range data {
-		intValue, err := strconv.ParseInt(v, 10, 32)
-		if err != nil {
-			return nil, err
-		}
-		intSlice = append(intSlice, int(intValue))
-	}
-	return intSlice, nil
-}
-
-func parseInt64s(data []string) ([]int64, error) {
-	var intSlice []int64
-
-	for _, v := range data {
-		intValue, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		intSlice = append(intSlice, int64(intValue))
-	}
-	return intSlice, nil
-}
-
-func parseFloat32s(data []string) ([]float32, error) {
-	var float32Slice []float32
-
-	for _, v := range data {
-		data, err := strconv.ParseFloat(v, 32)
-		if err != nil {
-			return nil, err
-		}
-		float32Slice = append(float32Slice, float32(data))
-	}
-	return float32Slice, nil
-}
-
-func parseFloat64s(data []string) ([]float64, error) {
-	var float64Slice []float64
-
-	for _, v := range data {
-		data, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return nil, err
-		}
-		float64Slice = append(float64Slice, float64(data))
-	}
-	return float64Slice, nil
-}
-
-func parseBools(data []string) ([]bool, error) {
-	var boolSlice []bool
-
-	for _, v := range data {
-		bvalue, err := strconv.ParseBool(v)
-		if err != nil {
-			return nil, err
-		}
-
-		boolSlice = append(boolSlice, bvalue)
-	}
-	return boolSlice, nil
-}
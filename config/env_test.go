@@ -1,11 +1,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
-	"github.com/stretchr/testify/assert"
 )
 
 type Config struct {
@@ -17,7 +22,7 @@ type Config struct {
 	Strings     []string      `env:"STRINGS"`
 	SepStrings  []string      `env:"SEPSTRINGS" envSeparator:":"`
 	Numbers     []int         `env:"NUMBERS"`
-	Numbers64   []int64         `env:"NUMBERS64"`
+	Numbers64   []int64       `env:"NUMBERS64"`
 	Bools       []bool        `env:"BOOLS"`
 	Duration    time.Duration `env:"DURATION"`
 	Float32     float32       `env:"FLOAT32"`
@@ -26,41 +31,30 @@ type Config struct {
 	Float64s    []float64     `env:"FLOAT64S"`
 }
 
-func init() {
-	enableCache = false
+// parseEnv parses v with Settings reading only env.
+func parseEnv(env map[string]string, v interface{}) error {
+	return NewSettingsWithLookup(MapLookup(env)).Parse(v)
 }
 
 func TestParsesEnv(t *testing.T) {
-	os.Setenv("somevar", "somevalue")
-	os.Setenv("othervar", "true")
-	os.Setenv("PORT", "8080")
-	os.Setenv("STRINGS", "string1,string2,string3")
-	os.Setenv("SEPSTRINGS", "string1:string2:string3")
-	os.Setenv("NUMBERS", "1,2,3,4")
-	os.Setenv("NUMBERS64", "1,2,2147483640,-2147483640")
-	os.Setenv("BOOLS", "t,TRUE,0,1")
-	os.Setenv("DURATION", "1s")
-	os.Setenv("FLOAT32", "3.40282346638528859811704183484516925440e+38")
-	os.Setenv("FLOAT64", "1.797693134862315708145274237317043567981e+308")
-	os.Setenv("FLOAT32S", "1.0,2.0,3.0")
-	os.Setenv("FLOAT64S", "1.0,2.0,3.0")
-
-	defer os.Setenv("somevar", "")
-	defer os.Setenv("othervar", "")
-	defer os.Setenv("PORT", "")
-	defer os.Setenv("STRINGS", "")
-	defer os.Setenv("SEPSTRINGS", "")
-	defer os.Setenv("NUMBERS", "")
-	defer os.Setenv("NUMBERS64", "")
-	defer os.Setenv("BOOLS", "")
-	defer os.Setenv("DURATION", "")
-	defer os.Setenv("FLOAT32", "")
-	defer os.Setenv("FLOAT64", "")
-	defer os.Setenv("FLOAT32S", "")
-	defer os.Setenv("FLOAT64S", "")
+	env := map[string]string{
+		"somevar":    "somevalue",
+		"othervar":   "true",
+		"PORT":       "8080",
+		"STRINGS":    "string1,string2,string3",
+		"SEPSTRINGS": "string1:string2:string3",
+		"NUMBERS":    "1,2,3,4",
+		"NUMBERS64":  "1,2,2147483640,-2147483640",
+		"BOOLS":      "t,TRUE,0,1",
+		"DURATION":   "1s",
+		"FLOAT32":    "3.40282346638528859811704183484516925440e+38",
+		"FLOAT64":    "1.797693134862315708145274237317043567981e+308",
+		"FLOAT32S":   "1.0,2.0,3.0",
+		"FLOAT64S":   "1.0,2.0,3.0",
+	}
 
 	cfg := Config{}
-	assert.NoError(t, parse(&cfg))
+	assert.NoError(t, parseEnv(env, &cfg))
 	assert.Equal(t, "somevalue", cfg.Some)
 	assert.Equal(t, true, cfg.Other)
 	assert.Equal(t, 8080, cfg.Port)
@@ -81,7 +75,7 @@ func TestParsesEnv(t *testing.T) {
 
 func TestEmptyVars(t *testing.T) {
 	cfg := Config{}
-	assert.NoError(t, parse(&cfg))
+	assert.NoError(t, parseEnv(nil, &cfg))
 	assert.Equal(t, "", cfg.Some)
 	assert.Equal(t, false, cfg.Other)
 	assert.Equal(t, 0, cfg.Port)
@@ -93,28 +87,30 @@ func TestEmptyVars(t *testing.T) {
 
 func TestPassAnInvalidPtr(t *testing.T) {
 	var thisShouldBreak int
-	assert.Error(t, parse(&thisShouldBreak))
+	assert.Error(t, parseEnv(nil, &thisShouldBreak))
 }
 
 func TestPassReference(t *testing.T) {
 	cfg := Config{}
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(nil, cfg))
 }
 
 func TestInvalidBool(t *testing.T) {
-	os.Setenv("othervar", "should-be-a-bool")
-	defer os.Setenv("othervar", "")
+	env := map[string]string{
+		"othervar": "should-be-a-bool",
+	}
 
 	cfg := Config{}
-	assert.Error(t, parse(&cfg))
+	assert.Error(t, parseEnv(env, &cfg))
 }
 
 func TestInvalidInt(t *testing.T) {
-	os.Setenv("PORT", "should-be-an-int")
-	defer os.Setenv("PORT", "")
+	env := map[string]string{
+		"PORT": "should-be-an-int",
+	}
 
 	cfg := Config{}
-	assert.Error(t, parse(&cfg))
+	assert.Error(t, parseEnv(env, &cfg))
 }
 
 func TestInvalidBoolsSlice(t *testing.T) {
@@ -122,28 +118,31 @@ func TestInvalidBoolsSlice(t *testing.T) {
 		BadBools []bool `env:"BADBOOLS"`
 	}
 
-	os.Setenv("BADBOOLS", "t,f,TRUE,faaaalse")
+	env := map[string]string{
+		"BADBOOLS": "t,f,TRUE,faaaalse",
+	}
 	cfg := &config{}
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(env, cfg))
 }
 
 func TestInvalidDuration(t *testing.T) {
-	os.Setenv("DURATION", "should-be-a-valid-duration")
-	defer os.Setenv("DURATION", "")
+	env := map[string]string{
+		"DURATION": "should-be-a-valid-duration",
+	}
 
 	cfg := Config{}
-	assert.Error(t, parse(&cfg))
+	assert.Error(t, parseEnv(env, &cfg))
 }
 
 func TestParsesDefaultConfig(t *testing.T) {
 	cfg := Config{}
-	assert.NoError(t, parse(&cfg))
+	assert.NoError(t, parseEnv(nil, &cfg))
 	assert.Equal(t, "postgres://localhost:5432/db", cfg.DatabaseURL)
 }
 
 func TestParseStructWithoutEnvTag(t *testing.T) {
 	cfg := Config{}
-	assert.NoError(t, parse(&cfg))
+	assert.NoError(t, parseEnv(nil, &cfg))
 	assert.Empty(t, cfg.NotAnEnv)
 }
 
@@ -151,9 +150,11 @@ func TestParseStructWithInvalidFieldKind(t *testing.T) {
 	type config struct {
 		WontWorkByte byte `env:"BLAH"`
 	}
-	os.Setenv("BLAH", "a")
+	env := map[string]string{
+		"BLAH": "a",
+	}
 	cfg := config{}
-	assert.Error(t, parse(&cfg))
+	assert.Error(t, parseEnv(env, &cfg))
 }
 
 func TestUnsupportedSliceType(t *testing.T) {
@@ -161,11 +162,12 @@ func TestUnsupportedSliceType(t *testing.T) {
 		WontWork []map[int]int `env:"WONTWORK"`
 	}
 
-	os.Setenv("WONTWORK", "1,2,3")
-	defer os.Setenv("WONTWORK", "")
+	env := map[string]string{
+		"WONTWORK": "1,2,3",
+	}
 
 	cfg := &config{}
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(env, cfg))
 }
 
 func TestBadSeparator(t *testing.T) {
@@ -174,10 +176,11 @@ func TestBadSeparator(t *testing.T) {
 	}
 
 	cfg := &config{}
-	os.Setenv("WONTWORK", "1,2,3,4")
-	defer os.Setenv("WONTWORK", "")
+	env := map[string]string{
+		"WONTWORK": "1,2,3,4",
+	}
 
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(env, cfg))
 }
 
 func TestNoErrorRequiredSet(t *testing.T) {
@@ -187,9 +190,10 @@ func TestNoErrorRequiredSet(t *testing.T) {
 
 	cfg := &config{}
 
-	os.Setenv("IS_REQUIRED", "val")
-	defer os.Setenv("IS_REQUIRED", "")
-	assert.NoError(t, parse(cfg))
+	env := map[string]string{
+		"IS_REQUIRED": "val",
+	}
+	assert.NoError(t, parseEnv(env, cfg))
 	assert.Equal(t, "val", cfg.IsRequired)
 }
 
@@ -199,7 +203,7 @@ func TestErrorRequiredNotSet(t *testing.T) {
 	}
 
 	cfg := &config{}
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(nil, cfg))
 }
 
 func TestEmptyOption(t *testing.T) {
@@ -209,9 +213,10 @@ func TestEmptyOption(t *testing.T) {
 
 	cfg := &config{}
 
-	os.Setenv("VAR", "val")
-	defer os.Setenv("VAR", "")
-	assert.NoError(t, parse(cfg))
+	env := map[string]string{
+		"VAR": "val",
+	}
+	assert.NoError(t, parseEnv(env, cfg))
 	assert.Equal(t, "val", cfg.Var)
 }
 
@@ -221,8 +226,385 @@ func TestErrorOptionNotRecognized(t *testing.T) {
 	}
 
 	cfg := &config{}
-	assert.Error(t, parse(cfg))
+	assert.Error(t, parseEnv(nil, cfg))
+
+}
+
+func TestParseNestedStruct(t *testing.T) {
+	type connection struct {
+		MaxOpen int `env:"max_open"`
+		MaxIdle int `env:"max_idle" envDefault:"2"`
+	}
+	type config struct {
+		Name       string     `env:"go2_test.name"`
+		Connection connection `env:"go2_test.connection"`
+		ORM        *struct {
+			ShowSQL bool `env:"show_sql"`
+		} `env:"go2_test.orm"`
+		connection
+	}
+
+	env := map[string]string{
+		"go2_test": `{"name": "db", "connection": {"max_open": 10}, "orm": {"show_sql": true}}`,
+		"max_open": "5",
+	}
+
+	cfg := &config{}
+	assert.NoError(t, parseEnv(env, cfg))
+	assert.Equal(t, "db", cfg.Name)
+	assert.Equal(t, 10, cfg.Connection.MaxOpen)
+	assert.Equal(t, 2, cfg.Connection.MaxIdle)
+	assert.Equal(t, true, cfg.ORM.ShowSQL)
+	assert.Equal(t, 5, cfg.connection.MaxOpen)
+}
+
+func TestParseNestedStructError(t *testing.T) {
+	type config struct {
+		Connection struct {
+			MaxOpen int `env:"max_open"`
+		} `env:"go2_test.connection"`
+	}
+
+	env := map[string]string{
+		"go2_test": `{"connection": {"max_open": "ten"}}`,
+	}
+
+	cfg := &config{}
+	assert.Error(t, parseEnv(env, cfg))
+}
+
+func TestParseErrorsAggregated(t *testing.T) {
+	type config struct {
+		Port     int    `env:"PORT"`
+		Other    bool   `env:"othervar"`
+		Password int    `env:"PASSWORD,secret"`
+		Required string `env:"IS_REQUIRED,required"`
+	}
+
+	env := map[string]string{
+		"PORT":     "should-be-an-int",
+		"othervar": "should-be-a-bool",
+		"PASSWORD": "s3cret",
+	}
+
+	cfg := &config{}
+	err := parseEnv(env, cfg)
+	assert.Error(t, err)
+
+	perr, ok := err.(*ParseError)
+	assert.True(t, ok)
+	assert.Len(t, perr.Errors, 4)
+
+	assert.Equal(t, "Port", perr.Errors[0].Field)
+	assert.Equal(t, "PORT", perr.Errors[0].Key)
+	assert.Equal(t, "should-be-an-int", perr.Errors[0].Value)
+	assert.Equal(t, "Other", perr.Errors[1].Field)
+	assert.Equal(t, "***", perr.Errors[2].Value)
+	assert.NotContains(t, err.Error(), "s3cret")
+	assert.Equal(t, "Required", perr.Errors[3].Field)
+	assert.Equal(t, "IS_REQUIRED", perr.Errors[3].Key)
+
+	// the cause is dropped, strconv escapes quotes and short values are in every message
+	for _, secret := range []string{`ab"cd`, "e"} {
+		err = parseEnv(map[string]string{"PASSWORD": secret}, &struct {
+			Password int `env:"PASSWORD,secret"`
+		}{})
+		assert.EqualError(t, err, `Password: PASSWORD="***": Invalid value`)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type config struct {
+		Port    int           `env:"PORT" envMin:"1" envMax:"65535"`
+		Timeout time.Duration `env:"DURATION" envMin:"1s" envMax:"1m"`
+		Level   string        `env:"LEVEL" envOneOf:"debug,info,warn"`
+		Name    string        `env:"NAME" envPattern:"^[a-z]+$"`
+		Urls    []string      `env:"URLS,nonempty" envFormat:"url"`
+		Addr    string        `env:"ADDR" envFormat:"hostport"`
+		Ratio   float64       `env:"RATIO" envDefault:"0.5" envMax:"1"`
+	}
+
+	env := map[string]string{
+		"PORT":     "8080",
+		"DURATION": "30s",
+		"LEVEL":    "INFO",
+		"NAME":     "go",
+		"URLS":     "http://a:9200,https://b",
+		"ADDR":     "localhost:5432",
+	}
 
+	cfg := &config{}
+	assert.NoError(t, parseEnv(env, cfg))
+
+	env["PORT"] = "0"
+	env["DURATION"] = "2m"
+	env["LEVEL"] = "trace"
+	env["NAME"] = "Go2"
+	env["URLS"] = "http://a:9200,b"
+	env["ADDR"] = "localhost"
+
+	cfg = &config{}
+	err := parseEnv(env, cfg)
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 6)
+
+	env["PORT"] = ""
+	env["DURATION"] = ""
+	env["LEVEL"] = ""
+	env["NAME"] = ""
+	env["URLS"] = ""
+	env["ADDR"] = ""
+
+	cfg = &config{}
+	err = parseEnv(env, cfg)
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 1)
+	assert.Equal(t, "Urls", err.(*ParseError).Errors[0].Field)
+}
+
+type jsonLevel int
+
+func (l *jsonLevel) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = jsonLevel(len(s))
+	return nil
+}
+
+type upper string
+
+func TestParseDecoders(t *testing.T) {
+	RegisterParser(reflect.TypeOf(upper("")), func(s string) (interface{}, error) {
+		return strings.ToUpper(s), nil
+	})
+
+	type config struct {
+		IP      net.IP         `env:"IP"`
+		Time    time.Time      `env:"TIME"`
+		URL     url.URL        `env:"URL"`
+		URLPtr  *url.URL       `env:"URL"`
+		Pattern *regexp.Regexp `env:"PATTERN"`
+		Size    ByteSize       `env:"SIZE" envMax:"1GB"`
+		Level   jsonLevel      `env:"LEVEL"`
+		Upper   upper          `env:"UPPER"`
+	}
+
+	env := map[string]string{
+		"IP":      "10.0.0.1",
+		"TIME":    "2017-03-01T10:00:00Z",
+		"URL":     "https://user@example.com:8443/path",
+		"PATTERN": "^go[0-9]$",
+		"SIZE":    "10MB",
+		"LEVEL":   "debug",
+		"UPPER":   "abc",
+	}
+
+	cfg := &config{}
+	assert.NoError(t, parseEnv(env, cfg))
+	assert.Equal(t, "10.0.0.1", cfg.IP.String())
+	assert.Equal(t, time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC), cfg.Time)
+	assert.Equal(t, "example.com:8443", cfg.URL.Host)
+	assert.Equal(t, "/path", cfg.URLPtr.Path)
+	assert.True(t, cfg.Pattern.MatchString("go2"))
+	assert.Equal(t, 10*MB, cfg.Size)
+	assert.Equal(t, jsonLevel(5), cfg.Level)
+	assert.Equal(t, upper("ABC"), cfg.Upper)
+
+	env["SIZE"] = "2GB"
+	env["PATTERN"] = "("
+	err := parseEnv(env, &config{})
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 2)
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, want := range map[string]ByteSize{
+		"512":    512,
+		"512B":   512,
+		"64kb":   64 * KB,
+		"10MB":   10 * MB,
+		"1.5GiB": GB + GB/2,
+		"2T":     2 * TB,
+	} {
+		got, err := ParseByteSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"10XB", "-1KB", "NaN", "nanKB", "Inf", "16777216TB", "18446744073709551616", "1e30"} {
+		_, err := ParseByteSize(s)
+		assert.Error(t, err, s)
+	}
+	got, err := ParseByteSize("16777215TB")
+	assert.NoError(t, err)
+	assert.Equal(t, 16777215*TB, got)
+	assert.Equal(t, "10MB", (10 * MB).String())
+	assert.Equal(t, "1536MB", (GB + GB/2).String())
+}
+
+func TestParseJSONValues(t *testing.T) {
+	type node struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type config struct {
+		Urls      []string                 `env:"go2_test.urls"`
+		Timeouts  []time.Duration          `env:"go2_test.timeouts"`
+		Nodes     []node                   `env:"go2_test.nodes"`
+		Primary   node                     `env:"go2_test.primary"`
+		Backup    *node                    `env:"go2_test.backup"`
+		Weights   map[string]int           `env:"go2_test.weights"`
+		Intervals map[string]time.Duration `env:"go2_test.intervals"`
+		Tags      []string                 `env:"TAGS"`
+	}
+
+	env := map[string]string{
+		"go2_test": `{
+			"urls": ["http://a:9200", "http://b:9200"],
+			"timeouts": ["1s", "2m"],
+			"nodes": [{"name": "a", "port": 1}, {"name": "b", "port": 2}],
+			"primary": {"name": "p", "port": 5432},
+			"backup": {"name": "b"},
+			"weights": {"a": 1, "b": 2},
+			"intervals": {"poll": "30s"}
+		}`,
+		"TAGS": `["x", "y"]`,
+	}
+
+	cfg := &config{}
+	assert.NoError(t, parseEnv(env, cfg))
+	assert.Equal(t, []string{"http://a:9200", "http://b:9200"}, cfg.Urls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Minute}, cfg.Timeouts)
+	assert.Equal(t, []node{{"a", 1}, {"b", 2}}, cfg.Nodes)
+	assert.Equal(t, node{"p", 5432}, cfg.Primary)
+	assert.Equal(t, &node{Name: "b"}, cfg.Backup)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, cfg.Weights)
+	assert.Equal(t, map[string]time.Duration{"poll": 30 * time.Second}, cfg.Intervals)
+	assert.Equal(t, []string{"x", "y"}, cfg.Tags)
+
+	env["go2_test"] = `{"weights": {"a": "one"}, "nodes": {"name": "a"}}`
+	err := parseEnv(env, &config{})
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 2)
+}
+
+func TestParseScalarKinds(t *testing.T) {
+	type config struct {
+		Int       int             `env:"go2_test.int"`
+		Int8      int8            `env:"go2_test.int8"`
+		Int16     int16           `env:"go2_test.int16"`
+		Int32     int32           `env:"go2_test.int32"`
+		Uint      uint            `env:"go2_test.uint"`
+		Uint8     uint8           `env:"go2_test.uint8"`
+		Uint16    uint16          `env:"go2_test.uint16"`
+		Uint32    uint32          `env:"go2_test.uint32"`
+		Uint64    uint64          `env:"go2_test.uint64"`
+		IntPtr    *int            `env:"go2_test.int_ptr"`
+		BoolPtr   *bool           `env:"go2_test.bool_ptr"`
+		Unset     *int            `env:"go2_test.unset"`
+		Durations []time.Duration `env:"go2_test.durations"`
+		Uints     []uint16        `env:"go2_test.uints"`
+	}
+
+	env := map[string]string{
+		"go2_test": `{
+			"int": 4294967296, "int8": -128, "int16": 32767, "int32": -2147483648,
+			"uint": 4294967296, "uint8": 255, "uint16": 65535, "uint32": 4294967295, "uint64": 18446744073709551615,
+			"int_ptr": 0, "bool_ptr": false,
+			"durations": "1s,1h", "uints": "1,2"
+		}`,
+	}
+
+	cfg := &config{}
+	assert.NoError(t, parseEnv(env, cfg))
+	assert.Equal(t, 4294967296, cfg.Int)
+	assert.Equal(t, int8(-128), cfg.Int8)
+	assert.Equal(t, int16(32767), cfg.Int16)
+	assert.Equal(t, int32(-2147483648), cfg.Int32)
+	assert.Equal(t, uint(4294967296), cfg.Uint)
+	assert.Equal(t, uint8(255), cfg.Uint8)
+	assert.Equal(t, uint16(65535), cfg.Uint16)
+	assert.Equal(t, uint32(4294967295), cfg.Uint32)
+	assert.Equal(t, uint64(18446744073709551615), cfg.Uint64)
+	assert.Equal(t, 0, *cfg.IntPtr)
+	assert.Equal(t, false, *cfg.BoolPtr)
+	assert.Nil(t, cfg.Unset)
+	assert.Equal(t, []time.Duration{time.Second, time.Hour}, cfg.Durations)
+	assert.Equal(t, []uint16{1, 2}, cfg.Uints)
+
+	env["go2_test"] = `{"int8": 128, "uint8": -1, "uint16": 65536, "int32": 2147483648, "uints": "1,65536"}`
+	err := parseEnv(env, &config{})
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 5)
+}
+
+func TestParseEnvPrefix(t *testing.T) {
+	type elastic struct {
+		Urls        []string `env:"go2_elastic.urls"`
+		SniffEnable bool     `env:"go2_elastic.sniff.enable"`
+	}
+	type blobstore struct {
+		Name   string `env:"go2_blobstore.name"`
+		Bucket string `env:",required" vcap:"${go2_blobstore.name},bucket_name"`
+	}
+	type pair struct {
+		Primary   elastic `envPrefix:"go2_primary"`
+		Secondary elastic
+	}
+	type config struct {
+		Default elastic
+		Logs    elastic   `envPrefix:"go2_elastic_logs"`
+		Search  *elastic  `envPrefix:"go2_elastic_search"`
+		Store   blobstore `envPrefix:"go2_archive"`
+		Pair    pair      `envPrefix:"go2_pair"`
+	}
+
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION":   "{}",
+		"VCAP_SERVICES":      testVcapServices,
+		"go2_elastic":        `{"urls": ["http://default:9200"]}`,
+		"go2_elastic_logs":   `{"urls": ["http://logs:9200"], "sniff": {"enable": true}}`,
+		"go2_elastic_search": `{"urls": ["http://search:9200"]}`,
+		"go2_archive":        `{"name": "my-blobstore"}`,
+		"go2_pair":           `{"urls": ["http://pair:9200"]}`,
+		"go2_primary":        `{"urls": ["http://primary:9200"]}`,
+	}))
+
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, []string{"http://default:9200"}, cfg.Default.Urls)
+	assert.Equal(t, elastic{Urls: []string{"http://logs:9200"}, SniffEnable: true}, cfg.Logs)
+	assert.Equal(t, &elastic{Urls: []string{"http://search:9200"}}, cfg.Search)
+	assert.Equal(t, blobstore{Name: "my-blobstore", Bucket: "bucket"}, cfg.Store)
+
+	// the outer envPrefix doesn't rename the keys of an inner struct with its own
+	assert.Equal(t, []string{"http://primary:9200"}, cfg.Pair.Primary.Urls)
+	assert.Equal(t, []string{"http://pair:9200"}, cfg.Pair.Secondary.Urls)
+
+	d, err := s.Describe(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "go2_elastic.urls", d[0].Key)
+	assert.Equal(t, "go2_elastic_logs.urls", d[2].Key)
+	assert.Equal(t, "go2_elastic_search.sniff.enable", d[5].Key)
+	assert.Equal(t, "vcap:${go2_archive.name},bucket_name", d[7].Key)
+	assert.Equal(t, "go2_primary.urls", d[8].Key)
+	assert.Equal(t, "go2_pair.urls", d[10].Key)
+
+	err = s.Parse(&struct {
+		Store blobstore `envPrefix:"go2_missing"`
+	}{})
+	assert.EqualError(t, err, `Store.Bucket: Required service credential ${go2_missing.name},bucket_name is not bound`)
+
+	// the keys of different env names would be merged into one
+	type mixed struct {
+		Urls []string `env:"go2_elastic.urls"`
+		Name string   `env:"go2_inner.name"`
+	}
+	err = s.Parse(&struct {
+		Logs mixed `envPrefix:"go2_elastic_logs"`
+	}{})
+	assert.EqualError(t, err, `Logs: Env prefix go2_elastic_logs can't replace several env names go2_elastic, go2_inner`)
 }
 
 func ExampleParse() {
@@ -231,9 +613,11 @@ func ExampleParse() {
 		Port         int    `env:"PORT" envDefault:"3000"`
 		IsProduction bool   `env:"PRODUCTION"`
 	}
-	os.Setenv("HOME", "/tmp/fakehome")
+	env := map[string]string{
+		"HOME": "/tmp/fakehome",
+	}
 	cfg := config{}
-	parse(&cfg)
+	parseEnv(env, &cfg)
 	fmt.Println(cfg)
 	// Output: {/tmp/fakehome 3000 false}
 }
@@ -245,11 +629,13 @@ func ExampleParseRequiredField() {
 		IsProduction bool   `env:"PRODUCTION"`
 		SecretKey    string `env:"SECRET_KEY,required"`
 	}
-	os.Setenv("HOME", "/tmp/fakehome")
+	env := map[string]string{
+		"HOME": "/tmp/fakehome",
+	}
 	cfg := config{}
-	err := parse(&cfg)
+	err := parseEnv(env, &cfg)
 	fmt.Println(err)
-	// Output: Required environment variable SECRET_KEY is not set
+	// Output: SecretKey: Required environment variable SECRET_KEY is not set
 }
 
 func ExampleParseMultipleOptions() {
@@ -259,9 +645,11 @@ func ExampleParseMultipleOptions() {
 		IsProduction bool   `env:"PRODUCTION"`
 		SecretKey    string `env:"SECRET_KEY,required,option1"`
 	}
-	os.Setenv("HOME", "/tmp/fakehome")
+	env := map[string]string{
+		"HOME": "/tmp/fakehome",
+	}
 	cfg := config{}
-	err := parse(&cfg)
+	err := parseEnv(env, &cfg)
 	fmt.Println(err)
-	// Output: Env tag option option1 not supported.
+	// Output: SecretKey: Env tag option option1 not supported.
 }
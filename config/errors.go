@@ -0,0 +1,78 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// maskedValue replaces the value of secret fields in errors and logs.
+const maskedValue = "***"
+
+// errInvalidSecret replaces the cause of errors of secret fields, which may contain the value.
+var errInvalidSecret = errors.New("Invalid value")
+
+// FieldError describes why a single struct field could not be loaded.
+type FieldError struct {
+	Field string // name of the struct field, dotted for nested structs
+	Key   string // env key of the field
+	Value string // offending value, masked if the field is secret
+	Err   error  // underlying cause
+}
+
+func (e *FieldError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %s=%q: %v", e.Field, e.Key, e.Value, e.Err)
+}
+
+// ParseError is returned by Parse and lists every field that failed,
+// so that all misconfigured values can be reported at once.
+type ParseError struct {
+	Errors []*FieldError
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d errors occurred:", len(e.Errors))
+	for _, fe := range e.Errors {
+		fmt.Fprintf(&buf, "\n\t* %v", fe)
+	}
+	return buf.String()
+}
+
+// ReloadError is returned by Reload and Restore and lists the errors of every source,
+// service binding and watched struct, so that all of them can be reported at once.
+type ReloadError struct {
+	Errors []error
+}
+
+func (e *ReloadError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d errors occurred:", len(e.Errors))
+	for _, err := range e.Errors {
+		fmt.Fprintf(&buf, "\n\t* %v", err)
+	}
+	return buf.String()
+}
+
+// reloadError returns a ReloadError of errs, if any.
+func reloadError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ReloadError{Errors: errs}
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+)
+
+// sourceFlag is the source of values set by flags.
+const sourceFlag = "flag:-"
+
+// flagValue is a flag bound to an env key, see BindFlags.
+type flagValue struct {
+	key   string
+	value string
+	set   bool
+
+	field reflect.StructField // to check values as they are set
+}
+
+func (r *flagValue) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.value
+}
+
+func (r *flagValue) Set(s string) error {
+	if err := setValue(reflect.New(r.field.Type).Elem(), r.field, scalar(decodeEnv(s))); err != nil {
+		return err
+	}
+	r.value, r.set = s, true
+	return nil
+}
+
+// IsBoolFlag allows boolean flags without a value, e.g. -postgres-orm-enable.
+func (r *flagValue) IsBoolFlag() bool {
+	t := r.field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
+
+// FlagName returns the flag name of an env key: the go2_ prefix is dropped,
+// dots and underscores are replaced by dashes, e.g. go2_postgres.connection.max_open
+// is postgres-connection-max-open.
+func FlagName(key string) string {
+	key = strings.TrimPrefix(strings.ToLower(key), "go2_")
+	return strings.Replace(strings.Replace(key, ".", "-", -1), "_", "-", -1)
+}
+
+// BindFlags defines a flag on fs for each env key of the struct v points to, see FlagName.
+// Flags that are set take precedence over env values and envDefault in Parse, e.g.
+//
+//   env := postgres.PostgresEnv{}
+//   settings.BindFlags(flag.CommandLine, &env)
+//   flag.Parse()
+//   settings.Parse(&env)
+//
+//   $ app -postgres-connection-max-open 20
+//
+// The usage of a flag shows its env key and envDefault.
+func (r *Settings) BindFlags(fs *flag.FlagSet, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return ErrNotAStructPtr
+	}
+	return r.bindFlags(fs, t.Elem(), "", nil)
+}
+
+// BindFlags defines flags for the env keys of v on fs for AppSettings.
+func BindFlags(fs *flag.FlagSet, v interface{}) error {
+	return settings.BindFlags(fs, v)
+}
+
+func (r *Settings) bindFlags(fs *flag.FlagSet, t reflect.Type, prefix string, renames []envRename) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		key, _ := parseKeyForOption(f.Tag.Get("env"))
+		if isNested(f.Type) {
+			nt := f.Type
+			if nt.Kind() == reflect.Ptr {
+				nt = nt.Elem()
+			}
+			nested := renames
+			if envPrefix := f.Tag.Get("envPrefix"); envPrefix != "" {
+				r, err := newEnvRename(nt, joinKey(prefix, key), envPrefix)
+				if err != nil {
+					return err
+				}
+				nested = append(renames[:len(renames):len(renames)], r)
+			}
+			if err := r.bindFlags(fs, nt, joinKey(prefix, key), nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		key = renameKey(renames, joinKey(prefix, key))
+
+		name := FlagName(key)
+		if e := fs.Lookup(name); e != nil {
+			if fv, ok := e.Value.(*flagValue); ok && fv.key == key {
+				continue // bound by another struct
+			}
+			return errors.New("Flag " + name + " of env " + key + " is already defined")
+		}
+
+		fv := &flagValue{key: key, value: f.Tag.Get("envDefault"), field: f}
+		fs.Var(fv, name, "env "+key)
+
+		r.Lock()
+		if r.flags == nil {
+			r.flags = make(map[string]*flagValue)
+		}
+		r.flags[key] = fv
+		r.Unlock()
+	}
+	return nil
+}
+
+// lookupFlag returns the value of the flag bound to the env key, if it is set.
+func (r *Settings) lookupFlag(key string) (envValue, bool) {
+	r.Lock()
+	fv, ok := r.flags[key]
+	r.Unlock()
+	if !ok || !fv.set {
+		return envValue{}, false
+	}
+	return envValue{value: scalar(decodeEnv(fv.value)), source: sourceFlag + FlagName(key)}, true
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindFlags(t *testing.T) {
+	type config struct {
+		Name       string `env:"go2_test.name"`
+		Connection struct {
+			MaxOpen int `env:"max_open" envDefault:"10"`
+			MaxIdle int `env:"max_idle" envDefault:"2"`
+		} `env:"go2_test.connection"`
+		Enable bool     `env:"go2_test.orm.enable"`
+		Urls   []string `env:"go2_test.urls"`
+		Port   int      `env:"PORT" envDefault:"3000"`
+		Uri    string   `vcap:"postgres,uri"`
+	}
+
+	s := NewSettingsWithLookup(MapLookup(map[string]string{
+		"go2_test": `{"name": "env", "connection": {"max_open": 5, "max_idle": 4}}`,
+	}))
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	assert.NoError(t, s.BindFlags(fs, &config{}))
+	assert.NoError(t, s.BindFlags(fs, &config{}))
+
+	assert.NoError(t, fs.Parse([]string{
+		"-test-connection-max-open", "20",
+		"-test-orm-enable",
+		"-test-urls", `["http://a", "http://b"]`,
+	}))
+
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, "env", cfg.Name)
+	assert.Equal(t, 20, cfg.Connection.MaxOpen)
+	assert.Equal(t, 4, cfg.Connection.MaxIdle)
+	assert.True(t, cfg.Enable)
+	assert.Equal(t, []string{"http://a", "http://b"}, cfg.Urls)
+	assert.Equal(t, 3000, cfg.Port)
+
+	d, err := s.Describe(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "flag:-test-connection-max-open", d[1].Source)
+
+	assert.Error(t, fs.Parse([]string{"-port", "http"}))
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.PrintDefaults()
+	assert.Contains(t, buf.String(), "-test-connection-max-open value\n    \tenv go2_test.connection.max_open (default 10)")
+	assert.Contains(t, buf.String(), "-test-orm-enable\n    \tenv go2_test.orm.enable")
+
+	other := flag.NewFlagSet("other", flag.ContinueOnError)
+	other.String("port", "", "")
+	assert.Error(t, s.BindFlags(other, &config{}))
+	assert.Equal(t, "port", FlagName("PORT"))
+}
+
+func TestBindFlagsEnvPrefix(t *testing.T) {
+	type elastic struct {
+		Urls []string `env:"go2_elastic.urls"`
+	}
+	type config struct {
+		Logs   elastic `envPrefix:"go2_elastic_logs"`
+		Search elastic `envPrefix:"go2_elastic_search"`
+	}
+
+	s := NewSettingsWithLookup(MapLookup(map[string]string{}))
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	assert.NoError(t, s.BindFlags(fs, &config{}))
+	assert.NoError(t, fs.Parse([]string{"-elastic-logs-urls", "http://logs"}))
+	assert.Nil(t, fs.Lookup("elastic-urls"))
+
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, []string{"http://logs"}, cfg.Logs.Urls)
+	assert.Empty(t, cfg.Search.Urls)
+	assert.NotNil(t, fs.Lookup("elastic-search-urls"))
+
+	type mixed struct {
+		Urls []string `env:"go2_elastic.urls"`
+		Name string   `env:"go2_inner.name"`
+	}
+	err := s.BindFlags(flag.NewFlagSet("mixed", flag.ContinueOnError), &struct {
+		Logs mixed `envPrefix:"go2_elastic_logs"`
+	}{})
+	assert.EqualError(t, err, `Env prefix go2_elastic_logs can't replace several env names go2_elastic, go2_inner`)
+}
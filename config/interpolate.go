@@ -0,0 +1,183 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expand replaces references in s with env values:
+//
+//   ${VAR}               value of VAR
+//   ${VAR:-default}      value of VAR, or default if VAR is not set or empty
+//   ${go2_postgres.name} part of a JSON value, see GetEnv
+//   $${                  a literal ${
+//
+// Referenced values are expanded recursively. An error is returned for
+// references that are not terminated or refer back to themselves.
+//
+// If Interpolate is set, env values and the string leaves of JSON values are expanded
+// on lookup; references that cannot be expanded are left as they are.
+// Values referring to secrets, e.g. read from a _FILE or decrypted, are secret themselves.
+func (r *Settings) Expand(s string) (string, error) {
+	v, _, err := r.expand(s, nil)
+	return v, err
+}
+
+// expand replaces the references in s, stack holds the keys being expanded.
+// It reports whether any of the referenced values is secret.
+func (r *Settings) expand(s string, stack []string) (string, bool, error) {
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+
+	secret := false
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			out = append(out, "${"...)
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			out = append(out, s[i])
+			continue
+		}
+
+		end := closingBrace(s, i+2)
+		if end < 0 {
+			return s, false, fmt.Errorf("Unterminated reference in %q", s)
+		}
+		v, sec, err := r.resolve(s[i+2:end], stack)
+		if err != nil {
+			return s, false, err
+		}
+		out = append(out, v...)
+		secret = secret || sec
+		i = end
+	}
+	return string(out), secret, nil
+}
+
+// closingBrace returns the index of the brace closing the reference starting at i,
+// allowing nested references in defaults.
+func closingBrace(s string, i int) int {
+	depth := 1
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// resolve returns the expanded value of the reference "key" or "key:-default"
+// and whether it is secret. Secret files are read and encrypted values decrypted
+// as on lookup, secret values are not expanded.
+func (r *Settings) resolve(ref string, stack []string) (string, bool, error) {
+	key, def := ref, ""
+	hasDefault := false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		key, def, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	for _, k := range stack {
+		// a.b refers back to a and vice versa
+		if k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(key, k+".") {
+			return "", false, fmt.Errorf("Reference cycle: %s -> %s", strings.Join(stack, " -> "), key)
+		}
+	}
+
+	p := strings.Split(key, ".")
+	t := r.readEnv(p[0])
+	if len(p) > 1 {
+		v := traverse(p[1:], t.value)
+		f, ok := envValue{}, false
+		if v == nil {
+			f, ok = secretSibling(t.value, p[1:])
+		}
+		if ok {
+			t = f
+		} else {
+			t.value = v
+		}
+	}
+	if t.err != nil {
+		return "", false, t.err
+	}
+
+	secrets := make(map[string]error)
+	v := r.decryptNode(t.value, "", secrets)
+	for _, err := range secrets {
+		if err != nil {
+			return "", false, err
+		}
+	}
+	secret := t.secret || len(secrets) > 0
+
+	var s string
+	switch n := v.(type) {
+	case nil:
+	case string:
+		s = n
+	case map[string]interface{}, []interface{}:
+		if !secret {
+			v = r.expandNode(n, key, "", stack, secrets)
+			secret = len(secrets) > 0
+		}
+		b, _ := json.Marshal(v)
+		s = string(b)
+	default:
+		s = fmt.Sprintf("%v", n)
+	}
+
+	if s == "" && hasDefault {
+		return r.expand(def, stack)
+	}
+	if secret {
+		return s, true, nil
+	}
+	return r.expand(s, append(stack, key))
+}
+
+// expandNode expands the string leaves of a JSON value, key is the dotted key of node
+// and path its dotted path within the env value. The paths of leaves referring to secrets
+// are added to secrets, like decryptNode does.
+// The node is copied, values held by sources are not modified.
+func (r *Settings) expandNode(node interface{}, key, path string, stack []string, secrets map[string]error) interface{} {
+	switch t := node.(type) {
+	case string:
+		s, secret, err := r.expand(t, append(stack, key))
+		if err != nil {
+			return t
+		}
+		if secret {
+			secrets[path] = nil
+		}
+		return s
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = r.expandNode(v, key+"."+k, joinKey(path, k), stack, secrets)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = r.expandNode(v, fmt.Sprintf("%s.%d", key, i), joinKey(path, strconv.Itoa(i)), stack, secrets)
+		}
+		return a
+	}
+	return node
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolate(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"go2_config":   `{"interpolate": true}`,
+		"HOME":         "/home/go2",
+		"HOST":         "db.example.com",
+		"go2_postgres": `{"name": "pg", "host": "${HOST}", "uri": "postgres://${go2_postgres.host}:${PORT:-5432}/${go2_postgres.name}"}`,
+		"go2_urls":     `{"list": ["http://${HOST}", "$${HOST}"]}`,
+		"LITERAL":      "pa$$word ${",
+		"CYCLE_A":      "${CYCLE_B}",
+		"CYCLE_B":      "x${CYCLE_A}",
+		"SELF":         `{"a": "${SELF}"}`,
+		"NESTED":       "${UNSET:-${HOME}/data}",
+	}))
+
+	assert.True(t, s.Interpolate)
+	assert.Equal(t, "postgres://db.example.com:5432/pg", s.GetStringEnv("go2_postgres", "uri"))
+	assert.Equal(t, "http://db.example.com", s.GetStringEnv("go2_urls", "list", "0"))
+	assert.Equal(t, "${HOST}", s.GetStringEnv("go2_urls", "list", "1"))
+	assert.Equal(t, "pa$$word ${", s.GetStringEnv("LITERAL"))
+	assert.Equal(t, "${CYCLE_B}", s.GetStringEnv("CYCLE_A"))
+	assert.Equal(t, "${SELF}", s.GetStringEnv("SELF", "a"))
+	assert.Equal(t, "/home/go2/data", s.GetStringEnv("NESTED"))
+
+	_, err := s.Expand("${CYCLE_A}")
+	assert.Error(t, err)
+	_, err = s.Expand("${HOST")
+	assert.Error(t, err)
+	v, err := s.Expand("${HOME}/${go2_postgres.name}")
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/go2/pg", v)
+
+	type config struct {
+		URI string `env:"go2_postgres.uri"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, "postgres://db.example.com:5432/pg", cfg.URI)
+}
+
+func TestInterpolateDisabled(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"HOST": "db.example.com",
+		"URI":  "postgres://${HOST}",
+	}))
+
+	assert.False(t, s.Interpolate)
+	assert.Equal(t, "postgres://${HOST}", s.GetStringEnv("URI"))
+}
+
+func TestInterpolateSecrets(t *testing.T) {
+	k, _ := GenerateKey()
+	key, _ := ParseKey(k)
+	token, _ := Encrypt(key, "t0ken")
+
+	dir := writeFiles(t, map[string]string{
+		"key":      k + "\n",
+		"password": "hunter2\n",
+		"user":     "admin\n",
+	})
+	defer os.RemoveAll(dir)
+
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"go2_config":          `{"interpolate": true}`,
+		"go2_config_key_FILE": filepath.Join(dir, "key"),
+		"DB_PASSWORD_FILE":    filepath.Join(dir, "password"),
+		"TOKEN":               token,
+		"go2_db":              `{"user_FILE": "` + filepath.Join(dir, "user") + `"}`,
+		"go2_postgres":        `{"name": "pg", "uri": "postgres://u:${DB_PASSWORD}@h/db"}`,
+		"go2_api":             `{"url": "https://${go2_db.user}@api?token=${TOKEN}"}`,
+		"go2_web":             `{"url": "https://${go2_postgres.name}"}`,
+	}))
+
+	assert.Equal(t, "postgres://u:hunter2@h/db", s.GetStringEnv("go2_postgres", "uri"))
+	assert.Equal(t, "https://admin@api?token=t0ken", s.GetStringEnv("go2_api", "url"))
+	assert.Equal(t, "https://pg", s.GetStringEnv("go2_web", "url"))
+
+	type config struct {
+		Name string `env:"go2_postgres.name"`
+		URI  string `env:"go2_postgres.uri"`
+		API  string `env:"go2_api.url"`
+		Web  string `env:"go2_web.url"`
+	}
+	desc, err := s.Describe(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pg", desc[0].Value)
+	assert.Equal(t, maskedValue, desc[1].Value)
+	assert.True(t, desc[1].Secret)
+	assert.Equal(t, maskedValue, desc[2].Value)
+	assert.Equal(t, "https://pg", desc[3].Value)
+
+	str := s.String()
+	for _, secret := range []string{"hunter2", "t0ken", "admin", token} {
+		assert.False(t, strings.Contains(str, secret), secret)
+	}
+	assert.Contains(t, str, "https://pg")
+
+	v, err := s.Expand("${TOKEN}")
+	assert.NoError(t, err)
+	assert.Equal(t, "t0ken", v)
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+)
+
+// Profiles override env values per environment, e.g. dev, test, staging or prod.
+// The active profiles are named by go2_profile, separated by commas, and the overrides
+// are kept in a profiles value of any source, e.g. in config.yaml:
+//
+//   go2_logging:
+//     level: INFO
+//     format: json
+//   profiles:
+//     dev:
+//       go2_logging:
+//         level: DEBUG
+//
+// With go2_profile=dev, go2_logging.level is DEBUG and go2_logging.format is json.
+// JSON objects are merged with the base value, other values replace it.
+// Later profiles take precedence over earlier ones.
+
+// go2_profile names the active profiles.
+const go2_profile = "go2_profile"
+
+// profilesKey is the env name of the profile overrides.
+const profilesKey = "profiles"
+
+// activeProfiles returns the profiles named by go2_profile.
+func (r *Settings) activeProfiles() []string {
+	var profiles []string
+	for _, p := range strings.Split(r.GetStringEnv(go2_profile), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// readProfile returns the override of the env value of name in profile
+// from the first source that has one, and the name of the source.
+func (r *Settings) readProfile(profile, name string) (interface{}, string, bool) {
+	for _, src := range r.Sources() {
+		v, ok := src.Lookup(profilesKey)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			v = decodeEnv(s)
+		}
+		if v = traverse([]string{profile, name}, v); v != nil {
+			if s, ok := v.(string); ok {
+				v = decodeEnv(s)
+			}
+			return v, src.Name() + "#" + profilesKey + "." + profile, true
+		}
+	}
+	return nil, "", false
+}
+
+// mergeNode returns the JSON object over merged into base,
+// or over itself if either is not an object. base is not modified.
+func mergeNode(base, over interface{}) interface{} {
+	b, ok := base.(map[string]interface{})
+	o, ok2 := over.(map[string]interface{})
+	if !ok || !ok2 {
+		return over
+	}
+
+	m := make(map[string]interface{}, len(b)+len(o))
+	for k, v := range b {
+		m[k] = v
+	}
+	for k, v := range o {
+		m[k] = mergeNode(b[k], v)
+	}
+	return m
+}
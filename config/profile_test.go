@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+go2_logging:
+  level: INFO
+  format: json
+go2_test:
+  urls:
+    - http://base:9200
+profiles:
+  dev:
+    go2_logging:
+      level: DEBUG
+    PORT: 3000
+  local:
+    go2_test:
+      urls:
+        - http://localhost:9200
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	env := map[string]string{
+		"go2_profile": "dev, local",
+		"PORT":        "8080",
+		"profiles":    `{"local": {"go2_logging": {"format": "text"}}}`,
+	}
+	s := NewSettings(
+		NewEnvSourceWithLookup(MapLookup(env)),
+		NewFileSource(filepath.Join(dir, "config.yaml")),
+	)
+	assert.Equal(t, []string{"dev", "local"}, s.Profiles)
+
+	type config struct {
+		Level  string   `env:"go2_logging.level"`
+		Format string   `env:"go2_logging.format"`
+		Urls   []string `env:"go2_test.urls"`
+		Port   int      `env:"PORT"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, &config{
+		Level:  "DEBUG",
+		Format: "text",
+		Urls:   []string{"http://localhost:9200"},
+		Port:   3000,
+	}, cfg)
+	assert.Equal(t, "env#profiles.local", s.SourceOf("go2_logging"))
+
+	delete(env, "go2_profile")
+	s = NewSettings(
+		NewEnvSourceWithLookup(MapLookup(env)),
+		NewFileSource(filepath.Join(dir, "config.yaml")),
+	)
+	assert.Nil(t, s.Profiles)
+	cfg = &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, &config{
+		Level:  "INFO",
+		Format: "json",
+		Urls:   []string{"http://base:9200"},
+		Port:   8080,
+	}, cfg)
+}
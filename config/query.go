@@ -0,0 +1,520 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON values such as VCAP_APPLICATION and VCAP_SERVICES can be queried with
+// JSON Pointers (RFC 6901) and a subset of JSONPath, e.g.
+//
+//   settings.GetEnvPointer("VCAP_APPLICATION", "/application_uris/0")
+//   settings.QueryEnv("VCAP_SERVICES", "$..[?(@.tags[*]=='sql')].credentials.uri")
+
+// Pointer returns the part of the JSON value doc referenced by the JSON Pointer p,
+// e.g. "/services/0/name", or nil if there is none. The pointer "" references doc itself,
+// ~1 and ~0 escape / and ~ in names.
+func Pointer(doc interface{}, p string) (interface{}, error) {
+	tokens, err := parsePointer(p)
+	if err != nil {
+		return nil, err
+	}
+
+	v := doc
+	for _, tok := range tokens {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[tok]
+		case []interface{}:
+			i, ok := arrayIndex(tok, len(t))
+			if !ok {
+				return nil, nil
+			}
+			v = t[i]
+		default:
+			return nil, nil
+		}
+	}
+	return v, nil
+}
+
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("Invalid JSON pointer %q: must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, tok := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses a JSON pointer array index, digits without leading zeros.
+func arrayIndex(tok string, n int) (int, bool) {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return 0, false
+	}
+	for _, c := range tok {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i >= n {
+		return 0, false
+	}
+	return i, true
+}
+
+// Query returns the parts of the JSON value doc matched by the JSONPath expression path.
+// The supported subset is:
+//
+//   $                  doc itself
+//   .name, ['name']    object member
+//   [n]                array element, negative n counts from the end
+//   [start:end]        array slice
+//   .*, [*]            all members or elements
+//   ..name, ..[...]    recursive descent
+//   [?(@.name=='x')]   members or elements for which the filter holds,
+//                      with ==, !=, <, <=, > or >= and a string, number, true, false or null
+//   [?(@.name)]        members or elements that have name
+//
+// Members of objects are matched in the order of their names.
+func Query(doc interface{}, path string) ([]interface{}, error) {
+	sels, err := compilePath(path, '$')
+	if err != nil {
+		return nil, err
+	}
+	return selectAll(sels, doc), nil
+}
+
+// selector returns the children of node it matches.
+type selector func(node interface{}) []interface{}
+
+func selectAll(sels []selector, node interface{}) []interface{} {
+	nodes := []interface{}{node}
+	for _, sel := range sels {
+		var next []interface{}
+		for _, n := range nodes {
+			next = append(next, sel(n)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// compilePath compiles a JSONPath expression starting with root, $ or @ in filters.
+func compilePath(path string, root byte) ([]selector, error) {
+	if path == "" || path[0] != root {
+		return nil, fmt.Errorf("Invalid JSONPath %q: must start with %c", path, root)
+	}
+
+	var sels []selector
+	s := path[1:]
+	for len(s) > 0 {
+		recursive := strings.HasPrefix(s, "..")
+		if recursive {
+			s = s[1:]
+			if strings.HasPrefix(s, ".[") {
+				s = s[1:]
+			}
+		}
+
+		var sel selector
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			name := strings.TrimSpace(s[1 : end+1])
+			if name == "" {
+				return nil, fmt.Errorf("Invalid JSONPath %q: empty name", path)
+			}
+			if name == "*" {
+				sel = children
+			} else {
+				sel = member(name)
+			}
+			s = s[end+1:]
+		case '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid JSONPath %q: unterminated [", path)
+			}
+			var err error
+			if sel, err = compileBracket(strings.TrimSpace(s[1:end])); err != nil {
+				return nil, fmt.Errorf("Invalid JSONPath %q: %v", path, err)
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath %q: unexpected %q", path, s)
+		}
+
+		if recursive {
+			sel = descend(sel)
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+// closingBracket returns the index of the ] closing the [ at s[0], skipping quoted strings.
+func closingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func compileBracket(expr string) (selector, error) {
+	switch {
+	case expr == "*":
+		return children, nil
+	case strings.HasPrefix(expr, "?(") && strings.HasSuffix(expr, ")"):
+		return compileFilter(strings.TrimSpace(expr[2 : len(expr)-1]))
+	case isQuoted(expr):
+		name, err := unquote(expr)
+		if err != nil {
+			return nil, err
+		}
+		return member(name), nil
+	case strings.Contains(expr, ":"):
+		return compileSlice(expr)
+	}
+
+	idx, err := strconv.Atoi(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %q", expr)
+	}
+	return func(node interface{}) []interface{} {
+		a, ok := node.([]interface{})
+		if !ok {
+			return nil
+		}
+		i := idx
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 || i >= len(a) {
+			return nil
+		}
+		return []interface{}{a[i]}
+	}, nil
+}
+
+func compileSlice(expr string) (selector, error) {
+	p := strings.SplitN(expr, ":", 2)
+	bound := func(s string, def int) (func(int) int, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return func(n int) int {
+				if def < 0 {
+					return n
+				}
+				return def
+			}, nil
+		}
+		idx, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slice %q", expr)
+		}
+		return func(n int) int {
+			i := idx
+			if i < 0 {
+				i += n
+			}
+			switch {
+			case i < 0:
+				return 0
+			case i > n:
+				return n
+			}
+			return i
+		}, nil
+	}
+	start, err := bound(p[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := bound(p[1], -1)
+	if err != nil {
+		return nil, err
+	}
+	return func(node interface{}) []interface{} {
+		a, ok := node.([]interface{})
+		if !ok {
+			return nil
+		}
+		i, j := start(len(a)), end(len(a))
+		if i >= j {
+			return nil
+		}
+		return append([]interface{}(nil), a[i:j]...)
+	}, nil
+}
+
+// filterOps are the comparison operators of filters, two character operators first.
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func compileFilter(expr string) (selector, error) {
+	left, op, right := expr, "", ""
+	if i, o := indexOp(expr); i >= 0 {
+		left, op, right = strings.TrimSpace(expr[:i]), o, strings.TrimSpace(expr[i+len(o):])
+	}
+
+	sels, err := compilePath(left, '@')
+	if err != nil {
+		return nil, err
+	}
+	var lit interface{}
+	if op != "" {
+		if lit, err = parseLiteral(right); err != nil {
+			return nil, err
+		}
+	}
+
+	match := func(node interface{}) bool {
+		for _, v := range selectAll(sels, node) {
+			if op == "" || compare(v, op, lit) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(node interface{}) []interface{} {
+		var a []interface{}
+		for _, c := range children(node) {
+			if match(c) {
+				a = append(a, c)
+			}
+		}
+		return a
+	}, nil
+}
+
+// indexOp returns the index of the first comparison operator outside of quotes.
+func indexOp(expr string) (int, string) {
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		default:
+			for _, op := range filterOps {
+				if strings.HasPrefix(expr[i:], op) {
+					return i, op
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseLiteral(s string) (interface{}, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if isQuoted(s) {
+		return unquote(s)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal %q", s)
+	}
+	return f, nil
+}
+
+// compare compares a JSON value with a literal, values of different types are not equal.
+func compare(v interface{}, op string, lit interface{}) bool {
+	var c int
+	switch l := lit.(type) {
+	case float64:
+		f, ok := toNumber(v)
+		if !ok {
+			return op == "!="
+		}
+		switch {
+		case f < l:
+			c = -1
+		case f > l:
+			c = 1
+		}
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return op == "!="
+		}
+		c = strings.Compare(s, l)
+	default:
+		// true, false and null
+		eq := v == lit
+		switch op {
+		case "==":
+			return eq
+		case "!=":
+			return !eq
+		}
+		return false
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+func isQuoted(s string) bool {
+	return len(s) > 1 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '"' {
+		return strconv.Unquote(s)
+	}
+	return strings.Replace(s[1:len(s)-1], `\'`, `'`, -1), nil
+}
+
+func member(name string) selector {
+	return func(node interface{}) []interface{} {
+		if m, ok := node.(map[string]interface{}); ok {
+			if v, ok := m[name]; ok {
+				return []interface{}{v}
+			}
+		}
+		return nil
+	}
+}
+
+// children returns the elements of an array or the members of an object by name.
+func children(node interface{}) []interface{} {
+	switch t := node.(type) {
+	case []interface{}:
+		return t
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		a := make([]interface{}, len(keys))
+		for i, k := range keys {
+			a[i] = t[k]
+		}
+		return a
+	}
+	return nil
+}
+
+// descend applies sel to node and all of its descendants.
+func descend(sel selector) selector {
+	var walk func(node interface{}, a []interface{}) []interface{}
+	walk = func(node interface{}, a []interface{}) []interface{} {
+		a = append(a, sel(node)...)
+		for _, c := range children(node) {
+			a = walk(c, a)
+		}
+		return a
+	}
+	return func(node interface{}) []interface{} {
+		return walk(node, nil)
+	}
+}
+
+// GetEnvPointer returns the part of the env value of name referenced by the JSON Pointer p,
+// see Pointer.
+func (r *Settings) GetEnvPointer(name, p string) (interface{}, error) {
+	v, err := Pointer(r.getEnv(name), p)
+	return floatNumbers(v), err
+}
+
+// QueryEnv returns the parts of the env value of name matched by the JSONPath expression path,
+// see Query.
+func (r *Settings) QueryEnv(name, path string) ([]interface{}, error) {
+	a, err := Query(r.getEnv(name), path)
+	if a != nil {
+		a = floatNumbers(a).([]interface{})
+	}
+	return a, err
+}
+
+// isQuery reports whether a GetEnv path is a JSON Pointer or JSONPath expression.
+func isQuery(p string) bool {
+	return strings.HasPrefix(p, "/") || strings.HasPrefix(p, "$")
+}
+
+func (r *Settings) queryEnv(name, p string) (interface{}, error) {
+	if strings.HasPrefix(p, "/") {
+		return r.GetEnvPointer(name, p)
+	}
+	a, err := r.QueryEnv(name, p)
+	if err != nil || len(a) == 0 {
+		return nil, err
+	}
+	return a[0], nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testQueryServices = `{
+  "postgres": [
+    {"name": "primary-db", "tags": ["sql"], "credentials": {"uri": "postgres://primary", "port": 5432}},
+    {"name": "reporting-db", "tags": ["sql", "reporting"], "credentials": {"uri": "postgres://reporting", "port": 6432}}
+  ],
+  "p-rabbitmq-35": [
+    {"name": "queue", "tags": ["amqp"], "credentials": {"uri": "amqp://queue", "a/b": "slash", "m~n": "tilde"}}
+  ]
+}`
+
+func TestPointer(t *testing.T) {
+	doc := decodeEnv(testQueryServices)
+
+	for p, want := range map[string]interface{}{
+		"/postgres/1/name":                  "reporting-db",
+		"/p-rabbitmq-35/0/credentials/a~1b": "slash",
+		"/p-rabbitmq-35/0/credentials/m~0n": "tilde",
+		"/postgres/0/credentials/port":      json.Number("5432"),
+		"/postgres/2/name":                  nil,
+		"/postgres/-":                       nil,
+		"/postgres/01":                      nil,
+		"/postgres/-1":                      nil,
+		"/postgres/0/name/x":                nil,
+		"/missing":                          nil,
+	} {
+		v, err := Pointer(doc, p)
+		assert.NoError(t, err, p)
+		assert.Equal(t, want, v, p)
+	}
+
+	v, err := Pointer(doc, "")
+	assert.NoError(t, err)
+	assert.Equal(t, doc, v)
+
+	_, err = Pointer(doc, "postgres")
+	assert.Error(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	doc := decodeEnv(testQueryServices)
+
+	for path, want := range map[string][]interface{}{
+		"$.postgres[0].name":        {"primary-db"},
+		"$['postgres'][-1]['name']": {"reporting-db"},
+		"$.postgres[*].name":        {"primary-db", "reporting-db"},
+		"$.postgres[0:1].name":      {"primary-db"},
+		"$.postgres[5].name":        nil,
+		"$.*[*].name":               {"queue", "primary-db", "reporting-db"},
+		"$..uri":                    {"amqp://queue", "postgres://primary", "postgres://reporting"},
+		"$.postgres[?(@.name=='reporting-db')].credentials.uri": {"postgres://reporting"},
+		"$..[?(@.tags[*]=='sql')].name":                         {"primary-db", "reporting-db"},
+		"$..[?(@.credentials.port > 6000)].name":                {"reporting-db"},
+		"$..[?(@.credentials.port != 5432)].name":               {"reporting-db"},
+		"$.*[?(@.tags[1])].name":                                {"reporting-db"},
+		"$.postgres[?(@.name==\"primary-db\")].tags[0]":         {"sql"},
+	} {
+		v, err := Query(doc, path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, want, v, path)
+	}
+
+	for _, path := range []string{"postgres", "$.postgres[", "$.postgres[x]", "$.", "$.a[?(@.b==x)]", "$x"} {
+		_, err := Query(doc, path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestGetEnvQuery(t *testing.T) {
+	s := NewSettingsWithLookup(MapLookup(map[string]string{
+		"VCAP_SERVICES":    testQueryServices,
+		"VCAP_APPLICATION": `{"application_uris": ["a.example.com", "b.example.com"]}`,
+		"ARRAY":            `["a", "b"]`,
+	}))
+
+	assert.Equal(t, "b.example.com", s.GetStringEnv("VCAP_APPLICATION", "/application_uris/1"))
+	assert.Equal(t, "", s.GetStringEnv("VCAP_APPLICATION", "/application_uris/2"))
+	assert.Equal(t, "", s.GetStringEnv("VCAP_APPLICATION", "application_uris", "2"))
+	assert.Equal(t, "", s.GetStringEnv("VCAP_APPLICATION", "application_uris", "-1"))
+	assert.Equal(t, "postgres://reporting", s.GetStringEnv("VCAP_SERVICES", "$..[?(@.name=='reporting-db')].credentials.uri"))
+	assert.Equal(t, 6432, s.GetIntEnv("VCAP_SERVICES", "$.postgres[-1].credentials.port"))
+	assert.Equal(t, "b", s.GetStringEnv("ARRAY", "1"))
+
+	v, err := s.QueryEnv("VCAP_SERVICES", "$.postgres[*].name")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"primary-db", "reporting-db"}, v)
+
+	_, err = s.GetEnvPointer("VCAP_SERVICES", "postgres")
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchers are notified by Reload of changed values.
+type watchers struct {
+	list []*watcher
+	next int
+
+	reload sync.Mutex // serializes Reload
+
+	sync.Mutex
+}
+
+type watcher struct {
+	id   int
+	key  string       // dotted env key, for Watch
+	typ  reflect.Type // struct type, for WatchStruct
+	last interface{}
+	fn   func(old, new interface{})
+}
+
+func (r *watchers) add(w *watcher) func() {
+	r.Lock()
+	defer r.Unlock()
+	r.next++
+	w.id = r.next
+	r.list = append(r.list, w)
+
+	return func() {
+		r.Lock()
+		defer r.Unlock()
+		for i, e := range r.list {
+			if e.id == w.id {
+				r.list = append(r.list[:i], r.list[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// subscribers returns the watchers of r, creating them for a zero Settings.
+func (r *Settings) subscribers() *watchers {
+	r.Lock()
+	defer r.Unlock()
+	if r.watchers == nil {
+		r.watchers = &watchers{}
+	}
+	return r.watchers
+}
+
+func (r *watchers) all() []*watcher {
+	r.Lock()
+	defer r.Unlock()
+	return append([]*watcher(nil), r.list...)
+}
+
+// Watch calls fn with the old and new value of the dotted env key,
+// e.g. "go2_logging.level", whenever Reload changes it.
+// It returns a function that cancels the subscription.
+func (r *Settings) Watch(key string, fn func(old, new interface{})) (cancel func()) {
+	return r.subscribers().add(&watcher{
+		key:  key,
+		last: r.getKey(key),
+		fn:   fn,
+	})
+}
+
+// WatchStruct calls fn with pointers to the old and new value of the struct v points to
+// whenever Reload changes any of its fields. v should have been loaded with Parse,
+// it is not modified by Reload. It returns a function that cancels the subscription.
+//
+//   env := PostgresEnv{}
+//   settings.Parse(&env)
+//   settings.WatchStruct(&env, func(old, new interface{}) {
+//       db.SetMaxOpenConns(new.(*PostgresEnv).MaxOpenConns)
+//   })
+func (r *Settings) WatchStruct(v interface{}, fn func(old, new interface{})) (cancel func(), err error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, ErrNotAStructPtr
+	}
+
+	last := reflect.New(t.Elem())
+	last.Elem().Set(reflect.ValueOf(v).Elem())
+
+	return r.subscribers().add(&watcher{
+		typ:  t.Elem(),
+		last: last.Interface(),
+		fn:   fn,
+	}), nil
+}
+
+func (r *Settings) getKey(key string) interface{} {
+	p := strings.Split(key, ".")
+	return r.GetEnv(p[0], p[1:]...)
+}
+
+// Reload reads the sources that implement Reloader again, drops cached values and
+// notifies the subscribers of Watch and WatchStruct of any changes.
+// The errors of the sources, service bindings and watched structs are returned
+// as a *ReloadError after all subscribers have been notified.
+func (r *Settings) Reload() error {
+	ws := r.subscribers()
+	ws.reload.Lock()
+	defer ws.reload.Unlock()
+
+	var errs []error
+	for _, src := range r.Sources() {
+		if rl, ok := src.(Reloader); ok {
+			if err := rl.Reload(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	r.reset()
+	r.Lock()
+	errs = append(errs, r.bindingErrs...)
+	r.Unlock()
+
+	errs = append(errs, r.notify()...)
+	return reloadError(errs)
+}
+
+// notify calls the subscribers whose values have changed and returns the parse errors
+// of watched structs. The caller holds the reload lock.
+func (r *Settings) notify() []error {
+	var errs []error
+	for _, w := range r.subscribers().all() {
+		var v interface{}
+		if w.typ != nil {
+			v = reflect.New(w.typ).Interface()
+			if err := r.Parse(v); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		} else {
+			v = r.getKey(w.key)
+		}
+
+		if reflect.DeepEqual(w.last, v) {
+			continue
+		}
+		old := w.last
+		w.last = v
+		w.fn(old, v)
+	}
+	return errs
+}
+
+// ReloadOnSignal calls Reload whenever one of the signals, SIGHUP by default, is received.
+// Reload errors are passed to onError if it is not nil.
+// It returns a function that stops reloading.
+func (r *Settings) ReloadOnSignal(onError func(error), sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sig...)
+
+	go func() {
+		for {
+			select {
+			case <-c:
+				r.reload(onError)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// WatchFiles checks the files of the sources, see FileSource and DotEnvSource,
+// every interval and calls Reload whenever one of them has been modified.
+// Reload errors are passed to onError if it is not nil.
+// It returns a function that stops watching.
+func (r *Settings) WatchFiles(interval time.Duration, onError func(error)) (stop func()) {
+	var paths []string
+	for _, src := range r.Sources() {
+		if f, ok := src.(interface {
+			Path() string
+		}); ok {
+			paths = append(paths, f.Path())
+		}
+	}
+
+	modTimes := func() []time.Time {
+		t := make([]time.Time, len(paths))
+		for i, p := range paths {
+			if fi, err := os.Stat(p); err == nil {
+				t[i] = fi.ModTime()
+			}
+		}
+		return t
+	}
+	modified := func(last, t []time.Time) bool {
+		for i := range t {
+			if !t[i].Equal(last[i]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	last := modTimes()
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				t := modTimes()
+				if modified(last, t) {
+					last = t
+					r.reload(onError)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// ReloadEvery calls Reload every interval, e.g. to refresh a RemoteSource.
+// Reload errors are passed to onError if it is not nil.
+// It returns a function that stops reloading.
+func (r *Settings) ReloadEvery(interval time.Duration, onError func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				r.reload(onError)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+func (r *Settings) reload(onError func(error)) {
+	if err := r.Reload(); err != nil && onError != nil {
+		onError(err)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+go2_logging:
+  level: INFO
+go2_postgres:
+  connection:
+    max_open: 10
+`,
+	})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	s := NewSettings(NewFileSource(path))
+
+	type config struct {
+		MaxOpen int `env:"go2_postgres.connection.max_open"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+
+	var levels []interface{}
+	cancel := s.Watch("go2_logging.level", func(old, new interface{}) {
+		levels = append(levels, old, new)
+	})
+
+	var structs []interface{}
+	_, err := s.WatchStruct(cfg, func(old, new interface{}) {
+		structs = append(structs, old, new)
+	})
+	assert.NoError(t, err)
+
+	// nothing changed
+	assert.NoError(t, s.Reload())
+	assert.Empty(t, levels)
+	assert.Empty(t, structs)
+
+	ioutil.WriteFile(path, []byte(`
+go2_logging:
+  level: DEBUG
+go2_postgres:
+  connection:
+    max_open: 20
+`), 0600)
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, []interface{}{"INFO", "DEBUG"}, levels)
+	assert.Equal(t, []interface{}{&config{10}, &config{20}}, structs)
+	assert.Equal(t, 10, cfg.MaxOpen)
+
+	cancel()
+	ioutil.WriteFile(path, []byte(`
+go2_logging:
+  level: WARN
+go2_postgres:
+  connection:
+    max_open: x
+`), 0600)
+	assert.Error(t, s.Reload())
+	assert.Len(t, levels, 2)
+	assert.Len(t, structs, 2)
+
+	_, err = s.WatchStruct(*cfg, nil)
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
+
+func TestReloadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": "go2_postgres: {connection: {max_open: 10}}",
+		"config.json": "{}",
+	})
+	defer os.RemoveAll(dir)
+
+	s := NewSettings(
+		NewFileSource(filepath.Join(dir, "config.yaml")),
+		NewFileSource(filepath.Join(dir, "config.json")),
+	)
+	type config struct {
+		MaxOpen int `env:"go2_postgres.connection.max_open"`
+	}
+	_, err := s.WatchStruct(&config{}, func(old, new interface{}) {})
+	assert.NoError(t, err)
+
+	ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("go2_postgres: {connection: {max_open: x}}"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte("[1"), 0600)
+	err = s.Reload()
+	assert.Error(t, err)
+	rerr, ok := err.(*ReloadError)
+	assert.True(t, ok)
+	if assert.Len(t, rerr.Errors, 2) {
+		assert.Contains(t, rerr.Errors[0].Error(), "config.json")
+		assert.Contains(t, rerr.Errors[1].Error(), "MaxOpen")
+	}
+	assert.Contains(t, err.Error(), "2 errors occurred:")
+
+	// the watched struct fails again
+	err = s.Restore(s.Snapshot())
+	assert.IsType(t, &ReloadError{}, err)
+}
+
+func TestReloadTriggers(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		".env": "LEVEL=INFO",
+	})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".env")
+
+	s := NewSettings(NewDotEnvSource(path))
+
+	changed := make(chan interface{}, 2)
+	s.Watch("LEVEL", func(old, new interface{}) {
+		changed <- new
+	})
+
+	stop := s.WatchFiles(10*time.Millisecond, nil)
+	defer stop()
+
+	ioutil.WriteFile(path, []byte("LEVEL=DEBUG"), 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	select {
+	case v := <-changed:
+		assert.Equal(t, "DEBUG", v)
+	case <-time.After(time.Second):
+		t.Fatal("file change not detected")
+	}
+
+	stop()
+	stopSignal := s.ReloadOnSignal(nil)
+	defer stopSignal()
+
+	ioutil.WriteFile(path, []byte("LEVEL=WARN"), 0600)
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skip(err)
+	}
+	select {
+	case v := <-changed:
+		assert.Equal(t, "WARN", v)
+	case <-time.After(time.Second):
+		t.Fatal("signal not handled")
+	}
+}
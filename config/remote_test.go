@@ -0,0 +1,160 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// configServer is a stand-in for a Spring Cloud Config server.
+type configServer struct {
+	sync.Mutex
+	path string
+	body string
+	code int
+}
+
+func (r *configServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	r.path = req.URL.Path
+	if r.code != 0 {
+		w.WriteHeader(r.code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(r.body))
+}
+
+func (r *configServer) set(body string, code int) {
+	r.Lock()
+	defer r.Unlock()
+	r.body, r.code = body, code
+}
+
+const testPropertySources = `{
+  "name": "orders",
+  "profiles": ["dev"],
+  "label": null,
+  "propertySources": [
+    {
+      "name": "https://git.example.com/config/orders-dev.yml",
+      "source": {
+        "go2_postgres.connection.max_open": 20,
+        "go2.logging.level": "DEBUG"
+      }
+    },
+    {
+      "name": "https://git.example.com/config/orders.yml",
+      "source": {
+        "go2_postgres.connection.max_open": 10,
+        "go2_postgres.orm.enable": true,
+        "go2_elastic.urls[0]": "http://a:9200",
+        "go2_elastic.urls[1]": "http://b:9200",
+        "go2_logging.level": "INFO",
+        "server.max-threads": 8,
+        "greeting": "hello"
+      }
+    }
+  ]
+}`
+
+func TestRemoteSource(t *testing.T) {
+	cs := &configServer{body: testPropertySources}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+
+	src := NewRemoteSource(ts.URL, "orders", "dev")
+	assert.NoError(t, src.Err())
+	assert.Equal(t, "/orders/dev", cs.path)
+	assert.Equal(t, "remote:/orders/dev", src.Name())
+
+	s := NewSettings(src)
+
+	assert.Equal(t, "DEBUG", s.GetEnv("go2_logging", "level"))
+	assert.Equal(t, "http://b:9200", s.GetEnv("go2_elastic", "urls", "1"))
+	assert.Equal(t, "hello", s.GetEnv("greeting"))
+
+	type config struct {
+		MaxOpen    int      `env:"go2_postgres.connection.max_open"`
+		Orm        bool     `env:"go2_postgres.orm.enable"`
+		Urls       []string `env:"go2_elastic.urls"`
+		MaxThreads int      `env:"server.max_threads"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, &config{
+		MaxOpen:    20,
+		Orm:        true,
+		Urls:       []string{"http://a:9200", "http://b:9200"},
+		MaxThreads: 8,
+	}, cfg)
+
+	fv, err := s.Describe(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "remote:/orders/dev", fv[0].Source)
+}
+
+func TestRemoteSourceLabel(t *testing.T) {
+	cs := &configServer{body: `{"propertySources": []}`}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+
+	src := NewRemoteSourceWithLabel(ts.URL+"/", "orders", "release-1", "dev", "cloud")
+	assert.NoError(t, src.Err())
+	assert.Equal(t, "/orders/dev,cloud/release-1", cs.path)
+
+	NewRemoteSource(ts.URL, "orders")
+	assert.Equal(t, "/orders/default", cs.path)
+}
+
+func TestRemoteSourceReload(t *testing.T) {
+	cs := &configServer{body: testPropertySources}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+
+	s := NewSettings(NewRemoteSource(ts.URL, "orders", "dev"))
+
+	var levels []interface{}
+	s.Watch("go2_logging.level", func(old, new interface{}) {
+		levels = append(levels, old, new)
+	})
+
+	cs.set(`{"propertySources": [{"name": "orders.yml", "source": {"go2_logging.level": "WARN"}}]}`, 0)
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, []interface{}{"DEBUG", "WARN"}, levels)
+
+	// the last values are kept if the server fails
+	cs.set("", http.StatusServiceUnavailable)
+	assert.Error(t, s.Reload())
+	assert.Equal(t, "WARN", s.GetEnv("go2_logging", "level"))
+}
+
+func TestRemoteSourceError(t *testing.T) {
+	cs := &configServer{code: http.StatusNotFound}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+
+	src := NewRemoteSource(ts.URL, "orders")
+	assert.Error(t, src.Err())
+	_, ok := src.Lookup("go2_logging")
+	assert.False(t, ok)
+
+	cs.set(`{"propertySources": [{"name": "orders.yml", "source": {"go2_elastic.urls[x]": "http://a:9200"}}]}`, 0)
+	assert.Error(t, src.Reload())
+
+	// sparse arrays, e.g. a huge index, are rejected
+	cs.set(`{"propertySources": [{"name": "orders.yml", "source": {"go2_elastic.urls[2000000000]": "http://a:9200"}}]}`, 0)
+	err := src.Reload()
+	assert.EqualError(t, err, "remote:/orders/default: array property go2_elastic.urls has 1 elements but index 2000000000")
+	cs.set(`{"propertySources": [{"name": "orders.yml", "source": {"x[0]": "a", "x[2]": "c", "y[0][1]": "b"}}]}`, 0)
+	assert.Error(t, src.Reload())
+
+	cs.set(`{"propertySources": [{"name": "orders.yml", "source": {"x[1]": "b", "x[0]": "a", "y[0][0]": "c"}}]}`, 0)
+	assert.NoError(t, src.Reload())
+	v, _ := src.Lookup("y")
+	assert.Equal(t, []interface{}{[]interface{}{"c"}}, v)
+}
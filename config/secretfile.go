@@ -0,0 +1,39 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// Secrets such as passwords and license keys can be kept out of the environment
+// by mounting them as files and referring to the files instead:
+//
+//   go2_newrelic={
+//     "enable": true,
+//     "license_FILE": "/etc/secrets/newrelic-license"
+//   }
+//   POSTGRES_PASSWORD_FILE=/etc/secrets/postgres-password
+//
+// If an env variable or a JSON key is not set, Settings reads the file named by the same
+// name with a _FILE (or _file) suffix. Struct fields with the "file" env tag option
+// hold the path of the file, e.g. License string `env:"go2_newrelic.license_path,file"`.
+// Values read from files are trimmed and treated as secret, i.e. masked in errors,
+// Describe and String.
+
+// fileSuffixes are appended to env names and JSON keys to refer to secret files.
+var fileSuffixes = []string{"_FILE", "_file"}
+
+// sourceSecretFile is the source of values read from secret files, followed by the path.
+const sourceSecretFile = "secretfile:"
+
+func readSecretFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"license":  "  abc123\n",
+		"password": "s3cret\n",
+		"creds":    `{"user": "admin"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	license := filepath.Join(dir, "license")
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"go2_newrelic":  `{"enable": true, "license_FILE": "` + license + `"}`,
+		"PASSWORD_FILE": filepath.Join(dir, "password"),
+		"CREDS_file":    filepath.Join(dir, "creds"),
+		"PASSWORD_PATH": filepath.Join(dir, "password"),
+		"MISSING_FILE":  filepath.Join(dir, "missing"),
+		"go2_blobstore": `{"key_FILE": "` + filepath.Join(dir, "missing") + `"}`,
+		"PLAIN":         "plain",
+		"PLAIN_FILE":    filepath.Join(dir, "password"),
+	}))
+
+	assert.Equal(t, "abc123", s.GetStringEnv("go2_newrelic", "license"))
+	assert.Equal(t, "s3cret", s.GetStringEnv("PASSWORD"))
+	assert.Equal(t, "admin", s.GetStringEnv("CREDS", "user"))
+	assert.Equal(t, "plain", s.GetStringEnv("PLAIN"))
+	assert.Equal(t, "", s.GetStringEnv("MISSING"))
+	assert.Equal(t, sourceSecretFile+license, s.lookupKey("go2_newrelic", "license").source)
+
+	type config struct {
+		License  string `env:"go2_newrelic.license"`
+		Password string `env:"PASSWORD"`
+		FromPath string `env:"PASSWORD_PATH,file"`
+		Plain    string `env:"PLAIN"`
+	}
+	cfg := &config{}
+	desc, err := s.Describe(cfg)
+	assert.NoError(t, err)
+	for _, f := range desc {
+		if f.Field == "Plain" {
+			assert.False(t, f.Secret)
+			continue
+		}
+		assert.True(t, f.Secret, f.Field)
+		assert.Equal(t, maskedValue, f.Value)
+		assert.True(t, strings.HasPrefix(f.Source, sourceSecretFile), f.Source)
+	}
+
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, config{"abc123", "s3cret", "s3cret", "plain"}, *cfg)
+	assert.NotContains(t, s.String(), "s3cret")
+
+	type broken struct {
+		Missing string `env:"MISSING"`
+		Key     string `env:"go2_blobstore.key"`
+	}
+	err = s.Parse(&broken{})
+	assert.Error(t, err)
+	assert.Len(t, err.(*ParseError).Errors, 2)
+}
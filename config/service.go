@@ -0,0 +1,251 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+// Service is a service bound to the app, from VCAP_SERVICES or SERVICE_BINDING_ROOT.
+// Its credentials are read with Credential and CredentialPath, which return an error
+// instead of panicking when a credential is missing or has a different shape, e.g.
+//
+//   s, err := settings.LookupService("my-blobstore")
+//   if err != nil {
+//       return err
+//   }
+//   bucket, err := s.Credential("bucket_name")
+//
+// Parse loads credentials into fields with a tag of the form `vcap:"names,credential.path"`.
+// Names are separated by | and looked up in order like LookupService, they may
+// contain ${...} references to env values, e.g.
+//
+//   type BlobstoreEnv struct {
+//       Name       string `env:"go2_blobstore.name"`
+//       BucketName string `env:",required" vcap:"${go2_blobstore.name}|p-blobstore,bucket_name"`
+//       SecretKey  string `env:",secret" vcap:"${go2_blobstore.name},secret_access_key"`
+//   }
+//
+// Use the env tag options for required and secret credentials. If the field also has an env key,
+// the env value takes precedence over the credential. A service that is not bound or has
+// no such credential leaves the field unset.
+type Service cfenv.Service
+
+// Credential returns the credential key as a string. Numbers and booleans are formatted,
+// other values are an error.
+func (r Service) Credential(key string) (string, error) {
+	return r.CredentialPath(key)
+}
+
+// CredentialPath returns the part of the credentials specified by path, a list of
+// object names and array indexes, as a string, e.g. CredentialPath("uris", "0").
+func (r Service) CredentialPath(path ...string) (string, error) {
+	v := traverse(path, map[string]interface{}(r.Credentials))
+	key := strings.Join(path, ".")
+
+	switch t := v.(type) {
+	case nil:
+		return "", fmt.Errorf("Service %s has no credential %s", r.Name, key)
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return "", fmt.Errorf("Service %s credential %s is not a string: %T", r.Name, key, v)
+}
+
+// LookupService looks up by name, then by label and then by tag and returns the first
+// service found. It returns an error if there is none, or if several services have the
+// label or tag, e.g. a primary and a reporting postgres, in which case look up by name.
+func (r *Settings) LookupService(names ...string) (Service, error) {
+	s, ok, err := r.lookupService(names)
+	if !ok && err == nil {
+		err = fmt.Errorf("Service not found: %s", strings.Join(nonEmpty(names), ", "))
+	}
+	return s, err
+}
+
+// lookupService is like LookupService but reports a service that is not found with ok.
+func (r *Settings) lookupService(names []string) (s Service, ok bool, err error) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		switch ss := r.getServices(name); len(ss) {
+		case 0:
+			continue
+		case 1:
+			return ss[0], true, nil
+		default:
+			return s, false, fmt.Errorf("Service %s is ambiguous, it matches %s", name, strings.Join(serviceNames(ss), ", "))
+		}
+	}
+	return s, false, nil
+}
+
+// LookupServices returns all services with any of the names, labels or tags, sorted by name.
+func (r *Settings) LookupServices(names ...string) []Service {
+	var ss []Service
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, s := range r.getServices(name) {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				ss = append(ss, s)
+			}
+		}
+	}
+	return sortServices(ss)
+}
+
+// ServicesWithTag returns the services with the tag, sorted by name.
+func (r *Settings) ServicesWithTag(tag string) []Service {
+	return r.filterServices(func(s Service) bool {
+		for _, t := range s.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// FindServices returns the services whose name matches the regular expression pattern,
+// sorted by name, e.g. FindServices("^orders-.*-db$").
+func (r *Settings) FindServices(pattern string) ([]Service, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return r.filterServices(func(s Service) bool {
+		return re.MatchString(s.Name)
+	}), nil
+}
+
+// AllServices returns all services bound to the app, sorted by name.
+func (r *Settings) AllServices() []Service {
+	return r.filterServices(func(Service) bool {
+		return true
+	})
+}
+
+func (r *Settings) filterServices(match func(Service) bool) []Service {
+	app := r.app()
+	if app == nil {
+		return nil
+	}
+	var ss []Service
+	for _, a := range app.Services {
+		for _, s := range a {
+			if match(Service(s)) {
+				ss = append(ss, Service(s))
+			}
+		}
+	}
+	return sortServices(ss)
+}
+
+// LookupServiceUri is like ServiceUri but returns an error if the service is not found
+// or has no uri credential.
+func (r *Settings) LookupServiceUri(names ...string) (string, error) {
+	s, err := r.LookupService(names...)
+	if err != nil {
+		return "", err
+	}
+	return s.Credential("uri")
+}
+
+// LookupPostgresUri is like PostgresUri but returns an error instead of "".
+func (r *Settings) LookupPostgresUri(a ...string) (string, error) {
+	return r.LookupServiceUri(append(a, postgresLabels...)...)
+}
+
+// LookupRabbitmqUri is like RabbitmqUri but returns an error instead of "".
+func (r *Settings) LookupRabbitmqUri(a ...string) (string, error) {
+	return r.LookupServiceUri(append(a, rabbitmqLabels...)...)
+}
+
+// sourceVcap is the source of values read from service credentials.
+const sourceVcap = "vcap:"
+
+// credential returns the credential of a service for a vcap tag, see Service,
+// and the source of the value, "vcap:" and the service name.
+func (p *parser) credential(tag string) (value interface{}, source string, err error) {
+	i := strings.Index(tag, ",")
+	if i < 0 {
+		return "", "", errors.New("Vcap tag " + tag + " has no credential path")
+	}
+	var names []string
+	for _, name := range strings.Split(tag[:i], "|") {
+		if name, err = p.settings.Expand(name); err != nil {
+			return "", "", err
+		}
+		names = append(names, name)
+	}
+
+	svc, ok, err := p.settings.lookupService(names)
+	if !ok {
+		return "", "", err
+	}
+	v := traverse(strings.Split(tag[i+1:], "."), map[string]interface{}(svc.Credentials))
+	if v == nil {
+		return "", "", nil
+	}
+	return scalar(v), sourceVcap + svc.Name, nil
+}
+
+// app returns Env under the lock, Reset and Restore replace it concurrently.
+func (r *Settings) app() *cfenv.App {
+	r.Lock()
+	defer r.Unlock()
+	return r.Env
+}
+
+// labels of the services looked up after the given names
+var (
+	postgresLabels = []string{"postgres", "postgresql"}
+	rabbitmqLabels = []string{"rabbitmq-36", "p-rabbitmq-35", "rabbitmq"}
+)
+
+// sortServices sorts services by name, the order of VCAP_SERVICES labels is random.
+func sortServices(ss []Service) []Service {
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Name < ss[j].Name
+	})
+	return ss
+}
+
+func serviceNames(ss []Service) []string {
+	names := make([]string, len(ss))
+	for i, s := range ss {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func nonEmpty(a []string) []string {
+	var s []string
+	for _, e := range a {
+		if e != "" {
+			s = append(s, e)
+		}
+	}
+	return s
+}
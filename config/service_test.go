@@ -0,0 +1,199 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+	"github.com/stretchr/testify/assert"
+)
+
+const testVcapServices = `{
+  "p-blobstore": [{
+    "name": "my-blobstore",
+    "label": "p-blobstore",
+    "tags": ["s3"],
+    "credentials": {
+      "bucket_name": "bucket",
+      "port": 9000,
+      "tls": true,
+      "uris": ["http://a", "http://b"],
+      "nested": {"key": "value"}
+    }
+  }],
+  "postgres": [{
+    "name": "my-db",
+    "label": "postgres",
+    "credentials": {"uri": "postgres://db.local/orders"}
+  }]
+}`
+
+func TestLookupService(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    testVcapServices,
+	}))
+
+	svc, err := s.LookupService("", "my-blobstore")
+	assert.NoError(t, err)
+	assert.Equal(t, "p-blobstore", svc.Label)
+	assert.Equal(t, []string{"s3"}, svc.Tags)
+
+	v, err := svc.Credential("bucket_name")
+	assert.NoError(t, err)
+	assert.Equal(t, "bucket", v)
+	v, err = svc.Credential("port")
+	assert.NoError(t, err)
+	assert.Equal(t, "9000", v)
+	v, err = svc.Credential("tls")
+	assert.NoError(t, err)
+	assert.Equal(t, "true", v)
+	v, err = svc.CredentialPath("uris", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://b", v)
+	v, err = svc.CredentialPath("nested", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	_, err = svc.Credential("missing")
+	assert.EqualError(t, err, "Service my-blobstore has no credential missing")
+	_, err = svc.Credential("nested")
+	assert.EqualError(t, err, "Service my-blobstore credential nested is not a string: map[string]interface {}")
+
+	_, err = s.LookupService("missing", "", "other")
+	assert.EqualError(t, err, "Service not found: missing, other")
+
+	uri, err := s.LookupPostgresUri("missing")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://db.local/orders", uri)
+	assert.Equal(t, "postgres://db.local/orders", s.PostgresUri())
+
+	_, err = s.LookupServiceUri("my-blobstore")
+	assert.EqualError(t, err, "Service my-blobstore has no credential uri")
+	_, err = s.LookupRabbitmqUri()
+	assert.Error(t, err)
+
+	// no panics
+	assert.Equal(t, "", s.ServiceUri("my-blobstore"))
+	assert.Equal(t, "", s.RabbitmqUri())
+	assert.Equal(t, "", NewSettings(NewMapSource("test", nil)).ServiceUri("my-db"))
+}
+
+func TestLookupAmbiguousServices(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES": `{
+  "postgres": [
+    {"name": "reporting-db", "label": "postgres", "tags": ["sql", "reporting"], "credentials": {"uri": "postgres://reporting"}},
+    {"name": "primary-db", "label": "postgres", "tags": ["sql"], "credentials": {"uri": "postgres://primary"}}
+  ],
+  "p-rabbitmq-35": [
+    {"name": "queue", "label": "p-rabbitmq-35", "tags": ["amqp"], "credentials": {"uri": "amqp://queue"}}
+  ]
+}`,
+	}))
+
+	_, err := s.LookupService("postgres")
+	assert.EqualError(t, err, "Service postgres is ambiguous, it matches primary-db, reporting-db")
+	_, err = s.LookupPostgresUri()
+	assert.Error(t, err)
+
+	uri, err := s.LookupPostgresUri("reporting-db")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://reporting", uri)
+
+	svc, err := s.LookupService("reporting")
+	assert.NoError(t, err)
+	assert.Equal(t, "reporting-db", svc.Name)
+	svc, err = s.LookupService("amqp")
+	assert.NoError(t, err)
+	assert.Equal(t, "queue", svc.Name)
+
+	names := serviceNames
+	assert.Equal(t, []string{"primary-db", "reporting-db"}, names(s.LookupServices("postgres")))
+	assert.Equal(t, []string{"primary-db", "queue", "reporting-db"}, names(s.LookupServices("sql", "queue", "reporting-db")))
+	assert.Equal(t, []string{"primary-db", "reporting-db"}, names(s.ServicesWithTag("sql")))
+	assert.Equal(t, []string{"primary-db", "queue", "reporting-db"}, names(s.AllServices()))
+
+	ss, err := s.FindServices("-db$")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"primary-db", "reporting-db"}, names(ss))
+	_, err = s.FindServices("(")
+	assert.Error(t, err)
+
+	assert.Equal(t, "primary-db", s.GetService("postgres").(cfenv.Service).Name)
+}
+
+func TestParseVcap(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    testVcapServices,
+		"go2_blobstore":    `{"name": "my-blobstore"}`,
+		"BUCKET":           "from-env",
+	}))
+
+	type config struct {
+		Name   string   `env:"go2_blobstore.name"`
+		Bucket string   `env:",required" vcap:"${go2_blobstore.name},bucket_name"`
+		Port   int      `vcap:"missing|p-blobstore,port"`
+		TLS    bool     `vcap:"s3,tls"`
+		Uris   []string `vcap:"my-blobstore,uris"`
+		Key    string   `env:",secret" vcap:"my-blobstore,nested.key"`
+		Uri    string   `env:"go2_db.uri" vcap:"postgres,uri"`
+		Other  string   `vcap:"missing,uri"`
+		Env    string   `env:"BUCKET" vcap:"my-blobstore,bucket_name"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, &config{
+		Name:   "my-blobstore",
+		Bucket: "bucket",
+		Port:   9000,
+		TLS:    true,
+		Uris:   []string{"http://a", "http://b"},
+		Key:    "value",
+		Uri:    "postgres://db.local/orders",
+		Env:    "from-env",
+	}, cfg)
+
+	d, err := s.Describe(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "vcap:${go2_blobstore.name},bucket_name", d[1].Key)
+	assert.Equal(t, "vcap:my-blobstore", d[1].Source)
+	assert.Equal(t, maskedValue, d[5].Value)
+	assert.Equal(t, "test", d[8].Source)
+
+	type required struct {
+		Password string `env:",required" vcap:"my-blobstore,password"`
+	}
+	err = s.Parse(&required{})
+	assert.EqualError(t, err, `Password: Required service credential my-blobstore,password is not bound`)
+
+	// fields with only a vcap tag don't look up an env key
+	src := &lookupSource{Source: NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    testVcapServices,
+	})}
+	s = NewSettings(src)
+	src.names = nil
+	assert.NoError(t, s.Parse(&struct {
+		Bucket string `env:",required" vcap:"my-blobstore,bucket_name"`
+		Port   int    `vcap:"p-blobstore,port"`
+	}{}))
+	for _, name := range src.names {
+		assert.False(t, name == "" || strings.HasPrefix(name, "_"), "lookup of %q", name)
+	}
+	_, ok := s.cache["env_"]
+	assert.False(t, ok)
+}
+
+// lookupSource records the names looked up in a source.
+type lookupSource struct {
+	Source
+	names []string
+}
+
+func (r *lookupSource) Lookup(name string) (interface{}, bool) {
+	r.names = append(r.names, name)
+	return r.Source.Lookup(name)
+}
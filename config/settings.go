@@ -28,132 +28,457 @@
 //   JSON
 //   #
 //   export MY_ENV
+//
+// Env values are looked up in a chain of sources: by default the process env,
+// a .env file and config.json/config.yaml files in the working directory, see Source.
+// A Spring Cloud Config server can be added as a source, see RemoteSource.
+// Values can be overridden per profile, e.g. dev or prod, see Settings.Profiles.
+//
+// Settings.Reload reads file and remote sources again and notifies subscribers of Settings.Watch
+// and Settings.WatchStruct; use Settings.ReloadOnSignal (SIGHUP), Settings.WatchFiles or
+// Settings.ReloadEvery to trigger it.
+//
+// Tests can derive Settings with overridden values with Settings.With, or replace the values
+// of AppSettings with Override or Settings.Snapshot and Settings.Restore.
 package config
 
 import (
-	"os"
 	"github.com/cloudfoundry-community/go-cfenv"
 	"strconv"
+	"strings"
 	"sync"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 )
 
 type Settings struct {
 	Env   *cfenv.App
 
+	// Interpolate enables ${...} references in env values, see Expand.
+	// It is initialized from go2_config.interpolate.
+	Interpolate bool
+
+	// NoCache disables caching of env values and services, every lookup reads the sources.
+	// It is initialized from go2_config.no_cache.
+	NoCache bool
+
+	// Profiles are the active profiles whose overrides in the profiles value
+	// of the sources are merged into env values, later profiles take precedence.
+	// It is initialized from go2_profile, e.g. go2_profile=dev,local.
+	Profiles []string
+
+	sources []Source //env sources in order of precedence
+
 	cache map[string]interface{} //cached env and uris
 
+	watchers *watchers //subscribers notified on reload
+
+	flags map[string]*flagValue //flags bound to env keys
+
+	bindingErrs []error //errors reading SERVICE_BINDING_ROOT
+
 	sync.Mutex
 }
 
-func (r Settings) String() string {
-	return fmt.Sprintf("%s", r.cache)
+// envValue is a cached env value and the name of the source it came from.
+type envValue struct {
+	value  interface{}
+	source string
+	secret bool  // read from a secret file or decrypted
+	err    error // error reading the secret file or decrypting
+
+	secrets map[string]error // dotted paths of decrypted JSON leaves and their errors
 }
 
-func (r Settings) getEnv(name string) interface{} {
+func (r *Settings) String() string {
 	r.Lock()
 	defer r.Unlock()
-	if !enableCache {
-		return os.Getenv(name)
+
+	m := make(map[string]interface{}, len(r.cache))
+	for k, v := range r.cache {
+		if t, ok := v.(envValue); ok {
+			if t.secret {
+				v = maskedValue
+			} else {
+				v = maskSecrets(t.value, "", t.secrets)
+			}
+		}
+		m[k] = v
+	}
+	return fmt.Sprintf("%s", m)
+}
+
+// maskSecrets returns a copy of the JSON node with the leaves at the dotted paths of secrets masked.
+func maskSecrets(node interface{}, path string, secrets map[string]error) interface{} {
+	if len(secrets) == 0 {
+		return node
+	}
+	if _, ok := secrets[path]; ok {
+		return maskedValue
 	}
+	switch t := node.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = maskSecrets(v, joinKey(path, k), secrets)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = maskSecrets(v, joinKey(path, strconv.Itoa(i)), secrets)
+		}
+		return a
+	}
+	return node
+}
 
+func (r *Settings) getEnv(name string) interface{} {
+	return r.lookupEnv(name).value
+}
+
+func (r *Settings) lookupEnv(name string) envValue {
 	key := "env_" + name
+	interpolate, noCache := r.options()
+
+	if !noCache {
+		r.Lock()
+		t, ok := r.cache[key]
+		r.Unlock()
+		if ok {
+			return t.(envValue)
+		}
+	}
 
-	var t interface{}
-	var ok bool
-	if t, ok = r.cache[key]; ok {
-		return t
+	t := r.readEnv(name)
+	secrets := make(map[string]error)
+	if interpolate && !t.secret {
+		t.value = r.expandNode(t.value, name, "", nil, secrets)
 	}
 
-	v := os.Getenv(name)
-	if err := json.Unmarshal([]byte(v), &t); err != nil {
-		r.cache[key] = v
-		return v
+	t.value = r.decryptNode(t.value, "", secrets)
+	if err, ok := secrets[""]; ok {
+		t.secret = true
+		if t.err == nil {
+			t.err = err
+		}
+	} else if len(secrets) > 0 {
+		t.secrets = secrets
+	}
+
+	if !noCache {
+		r.Lock()
+		r.setCache(key, t)
+		r.Unlock()
 	}
-	r.cache[key] = t
 	return t
 }
 
-func (r Settings) getService(name string) interface{} {
+// setCache caches v, creating the cache for a zero Settings. The caller holds the lock.
+func (r *Settings) setCache(key string, v interface{}) {
+	if r.cache == nil {
+		r.cache = make(map[string]interface{})
+	}
+	r.cache[key] = v
+}
+
+// Invalidate drops the cached value of the env name of the dotted key,
+// e.g. "go2_logging.level", so that it is read from the sources again.
+func (r *Settings) Invalidate(key string) {
+	name := strings.SplitN(key, ".", 2)[0]
+
 	r.Lock()
 	defer r.Unlock()
+	delete(r.cache, "env_"+name)
+}
 
-	key := "service_" + name
+// Reset drops all cached values and reads the services from VCAP_SERVICES
+// and SERVICE_BINDING_ROOT again. Use Reload to read file sources again as well.
+func (r *Settings) Reset() {
+	ws := r.subscribers()
+	ws.reload.Lock()
+	defer ws.reload.Unlock()
 
-	var t interface{}
-	var ok bool
-	if t, ok = r.cache[key]; ok {
+	r.reset()
+}
+
+// reset is Reset, the caller holds the reload lock so that the services read
+// from the sources are not stored after Restore has replaced them.
+func (r *Settings) reset() {
+	r.Lock()
+	for k := range r.cache {
+		delete(r.cache, k)
+	}
+	r.Unlock()
+
+	app, errs := r.currentApp()
+
+	r.Lock()
+	defer r.Unlock()
+	r.Env, r.bindingErrs = app, errs
+	for k := range r.cache {
+		// looked up in the previous Env meanwhile
+		if strings.HasPrefix(k, "service_") {
+			delete(r.cache, k)
+		}
+	}
+}
+
+// readEnv returns the raw value of name from the first source that has it,
+// with the overrides of the active profiles merged in.
+func (r *Settings) readEnv(name string) envValue {
+	t := r.readBaseEnv(name)
+	for _, p := range r.profiles() {
+		if v, source, ok := r.readProfile(p, name); ok {
+			t.value, t.source = mergeNode(t.value, v), source
+		}
+	}
+	return t
+}
+
+// readBaseEnv returns the raw value of name from the first source that has it.
+// If none has it, the value is read from the file named by NAME_FILE, see readSecretFile.
+func (r *Settings) readBaseEnv(name string) envValue {
+	sources := r.Sources()
+	for _, src := range sources {
+		if v, ok := src.Lookup(name); ok {
+			if s, ok := v.(string); ok {
+				v = decodeEnv(s)
+			}
+			return envValue{value: v, source: src.Name()}
+		}
+	}
+
+	for _, suffix := range fileSuffixes {
+		for _, src := range sources {
+			if v, ok := src.Lookup(name + suffix); ok {
+				if path, ok := v.(string); ok && path != "" {
+					s, err := readSecretFile(path)
+					return envValue{value: decodeEnv(s), source: sourceSecretFile + path, secret: true, err: err}
+				}
+			}
+		}
+	}
+	return envValue{value: ""}
+}
+
+// lookupKey returns the part of the env value of name specified by path.
+// If the part is not set, it is read from the file named by the sibling key
+// with a _FILE suffix, see readSecretFile.
+func (r *Settings) lookupKey(name string, path ...string) envValue {
+	t := r.lookupEnv(name)
+	if len(path) == 0 {
 		return t
 	}
 
-	s, err := r.Env.Services.WithName(name)
-	if err != nil {
-		ss, err := r.Env.Services.WithLabel(name)
-		if err != nil {
-			t = nil
-		} else {
+	m := t.value
+	switch m.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return envValue{}
+	}
 
-			t = ss[0]
+	v := traverse(path, m)
+	if v == nil {
+		if f, ok := secretSibling(m, path); ok {
+			return f
 		}
-	} else {
+		// not set, whatever source has the rest of the value
+		return envValue{secret: t.secret}
+	}
+	leaf := envValue{value: v, source: t.source, secret: t.secret}
+	if err, ok := t.secrets[strings.Join(path, ".")]; ok {
+		leaf.secret, leaf.err = true, err
+	}
+	return leaf
+}
 
-		t = *s
+// secretSibling reads the part of the JSON value m specified by path from the file
+// named by the sibling key with a _FILE suffix, if any.
+func secretSibling(m interface{}, path []string) (envValue, bool) {
+	parent, _ := traverse(path[:len(path)-1], m).(map[string]interface{})
+	for _, suffix := range fileSuffixes {
+		if p, ok := parent[path[len(path)-1]+suffix].(string); ok && p != "" {
+			s, err := readSecretFile(p)
+			return envValue{value: s, source: sourceSecretFile + p, secret: true, err: err}, true
+		}
+	}
+	return envValue{}, false
+}
+
+// SourceOf returns the name of the source the env value of name came from,
+// or "" if none of the sources has it.
+func (r *Settings) SourceOf(name string) string {
+	return r.lookupEnv(name).source
+}
+
+// Errors returns the errors of the sources reading their files or servers, see FileSource.Err,
+// and of reading the service bindings in SERVICE_BINDING_ROOT.
+// The values of a source with an error are missing or those last read successfully,
+// bindings that cannot be read are skipped.
+func (r *Settings) Errors() []error {
+	r.Lock()
+	errs := append([]error(nil), r.bindingErrs...)
+	r.Unlock()
+	for _, src := range r.Sources() {
+		if e, ok := src.(interface {
+			Err() error
+		}); ok {
+			if err := e.Err(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// Sources returns the env sources in order of precedence.
+func (r *Settings) Sources() []Source {
+	r.Lock()
+	defer r.Unlock()
+	return r.sources
+}
+
+// options returns Interpolate and NoCache under the lock, Restore replaces them concurrently.
+func (r *Settings) options() (interpolate, noCache bool) {
+	r.Lock()
+	defer r.Unlock()
+	return r.Interpolate, r.NoCache
+}
+
+// profiles returns Profiles under the lock, Restore replaces them concurrently.
+func (r *Settings) profiles() []string {
+	r.Lock()
+	defer r.Unlock()
+	return r.Profiles
+}
+
+// decodeEnv returns the JSON value of v or v itself if it is not JSON.
+// Numbers are kept as json.Number so that their string form is preserved.
+func decodeEnv(v string) interface{} {
+	var t interface{}
+	d := json.NewDecoder(strings.NewReader(v))
+	d.UseNumber()
+	if err := d.Decode(&t); err != nil || d.More() {
+		return v
+	}
+	return t
+}
+
+// getServices returns the service with the given name, or else the services
+// with the given label or tag, sorted by name.
+func (r *Settings) getServices(name string) []Service {
+	r.Lock()
+	defer r.Unlock()
+
+	key := "service_" + name
+
+	if t, ok := r.cache[key]; ok && !r.NoCache {
+		return t.([]Service)
+	}
+	if r.Env == nil {
+		return nil
+	}
+
+	var ss []cfenv.Service
+	if s, err := r.Env.Services.WithName(name); err == nil {
+		ss = []cfenv.Service{*s}
+	} else if ss, err = r.Env.Services.WithLabel(name); err != nil || len(ss) == 0 {
+		ss, _ = r.Env.Services.WithTag(name)
+	}
+	t := make([]Service, len(ss))
+	for i, s := range ss {
+		t[i] = Service(s)
+	}
+	t = sortServices(t)
+	if !r.NoCache {
+		r.setCache(key, t)
 	}
-	r.cache[key] = t
 
 	return t
 }
 
-// GetService looks up by name and then by label and returns the service
-// from VCAP_SERVICES environment variable
-func (r Settings) GetService(names ...string) interface{} {
+// GetService looks up by name, then by label and then by tag and returns the service
+// from VCAP_SERVICES environment variable or SERVICE_BINDING_ROOT.
+// If several services have the label or tag, the first by name is returned,
+// use LookupService to detect ambiguous names.
+func (r *Settings) GetService(names ...string) interface{} {
 	for _, name := range names {
 		if name == "" {
 			continue
 		}
-		s := r.getService(name)
-		if s != nil {
-			return s
+		if ss := r.getServices(name); len(ss) > 0 {
+			return cfenv.Service(ss[0])
 		}
 	}
 
 	return nil
 }
 
-func (r Settings) PostgresUri(a ...string) string {
-	a = append(a, "postgres")
-	return r.ServiceUri(a...)
+// PostgresUri returns the uri of the postgres service, or "" if it is not found,
+// see LookupPostgresUri.
+func (r *Settings) PostgresUri(a ...string) string {
+	uri, _ := r.LookupPostgresUri(a...)
+	return uri
 }
 
-func (r Settings) RabbitmqUri(a ...string) string {
-	a = append(a, "rabbitmq-36", "p-rabbitmq-35")
-	return r.ServiceUri(a...)
+// RabbitmqUri returns the uri of the rabbitmq service, or "" if it is not found,
+// see LookupRabbitmqUri.
+func (r *Settings) RabbitmqUri(a ...string) string {
+	uri, _ := r.LookupRabbitmqUri(a...)
+	return uri
 }
 
 // ServiceUri looks up by name and then by label and returns service uri
-// from the VCAP_SERVICES environment variable
-func (r Settings) ServiceUri(names ...string) string {
-	return r.GetService(names...).(cfenv.Service).Credentials["uri"].(string)
+// from the VCAP_SERVICES environment variable, or "" if it is not found, see LookupServiceUri.
+func (r *Settings) ServiceUri(names ...string) string {
+	uri, _ := r.LookupServiceUri(names...)
+	return uri
 }
 
 // GetEnv returns env value for the given name.
 // If the value is JSON and path is provided, return the part specified.
-func (r Settings) GetEnv(name string, path ...string) interface{} {
-	v := r.getEnv(name)
-	if v == nil || len(path) == 0 {
+// The path may also be a single JSON Pointer or JSONPath expression, see Pointer and Query,
+// e.g. GetEnv("VCAP_APPLICATION", "/application_uris/0") or
+// GetEnv("VCAP_SERVICES", "$..[?(@.name=='my-db')].credentials.uri").
+// JSONPath expressions return the first match, use QueryEnv for all matches.
+func (r *Settings) GetEnv(name string, path ...string) interface{} {
+	if len(path) == 1 && isQuery(path[0]) {
+		v, _ := r.queryEnv(name, path[0])
 		return v
 	}
-	m, ok := v.(map[string]interface{})
-	if !ok || m == nil {
-		return nil
+	return floatNumbers(r.lookupKey(name, path...).value)
+}
+
+// floatNumbers returns a copy of the JSON node with the json.Number values,
+// used internally to preserve the string form of numbers for Parse,
+// converted to float64 as returned by json.Unmarshal.
+func floatNumbers(node interface{}) interface{} {
+	switch t := node.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = floatNumbers(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = floatNumbers(v)
+		}
+		return a
 	}
-	return traverse(path, m)
+	return node
 }
 
 // GetEnv returns env string value for the given name.
 // If the value is JSON and path is provided, return the part specified.
-func (r Settings) GetStringEnv(name string, path ...string) string {
+func (r *Settings) GetStringEnv(name string, path ...string) string {
 	t := r.GetEnv(name, path...)
 
 	switch t.(type) {
@@ -170,7 +495,7 @@ func (r Settings) GetStringEnv(name string, path ...string) string {
 
 // GetEnv returns env boolean value for the given name.
 // If the value is JSON and path is provided, return the part specified.
-func (r Settings) GetBoolEnv(name string, path ...string) bool {
+func (r *Settings) GetBoolEnv(name string, path ...string) bool {
 	t := r.GetEnv(name, path...)
 
 	b, err := strconv.ParseBool(fmt.Sprintf("%v", t))
@@ -182,9 +507,17 @@ func (r Settings) GetBoolEnv(name string, path ...string) bool {
 
 // GetEnv returns env int value for the given name.
 // If the value is JSON and path is provided, return the part specified.
-func (r Settings) GetIntEnv(name string, path ...string) int {
+func (r *Settings) GetIntEnv(name string, path ...string) int {
 	t := r.GetEnv(name, path...)
 
+	if f, ok := t.(float64); ok {
+		// e.g. 1e3, fractions and values out of range are not ints
+		if i := int(f); f == math.Trunc(f) && float64(i) == f {
+			return i
+		}
+		return 0
+	}
+
 	i, err := strconv.Atoi(fmt.Sprintf("%v", t))
 	if err == nil {
 		return i
@@ -193,17 +526,19 @@ func (r Settings) GetIntEnv(name string, path ...string) int {
 	return 0
 }
 
-func (r Settings) Parse(v interface{}) error {
-	return parse(v)
+// Parse parses a struct containing `env` tags and loads its values from the sources of r.
+func (r *Settings) Parse(v interface{}) error {
+	return parseWith(r, v)
 }
 
 func traverse(path []string, t interface{}) interface{} {
 	var next = func() interface{} {
 		switch t.(type) {
 		case []interface{}:
+			a := t.([]interface{})
 			idx, err := strconv.Atoi(path[0])
-			if err == nil {
-				return t.([]interface{})[idx]
+			if err == nil && idx >= 0 && idx < len(a) {
+				return a[idx]
 			}
 		case map[string]interface{}:
 			return t.(map[string]interface{})[path[0]]
@@ -229,19 +564,100 @@ func traverse(path []string, t interface{}) interface{} {
 	return nil
 }
 
-func NewSettings() *Settings {
-	env, _ := cfenv.Current()
+// NewSettings returns Settings reading env values from the given sources
+// in order of precedence, or from DefaultSources if none are given.
+func NewSettings(sources ...Source) *Settings {
+	if len(sources) == 0 {
+		sources = DefaultSources()
+	}
 
-	return &Settings{
-		Env: env,
+	r := &Settings{
+		sources: sources,
 		cache: make(map[string]interface{}),
+		watchers: &watchers{},
 	}
+	r.Profiles = r.activeProfiles()
+	r.Interpolate = r.GetBoolEnv(go2_config, "interpolate")
+	r.NoCache = r.GetBoolEnv(go2_config, "no_cache")
+	r.Env, r.bindingErrs = r.currentApp()
+
+	return r
 }
 
-var (
-	settings = NewSettings()
-	enableCache = true // set to false for testing
-)
+// NewSettingsWithLookup returns Settings reading env values only from lookup,
+// e.g. for tests that should not depend on or modify the process env:
+//
+//   s := config.NewSettingsWithLookup(config.MapLookup(map[string]string{
+//       "go2_logging": `{"level": "DEBUG"}`,
+//   }))
+func NewSettingsWithLookup(lookup LookupFunc) *Settings {
+	return NewSettings(NewEnvSourceWithLookup(lookup))
+}
+
+// go2_config configures Settings itself, e.g.
+// go2_config={
+//   "interpolate": true,
+//   "no_cache": false
+// }
+const go2_config = "go2_config"
+
+// cfenvKeys are the env variables read by cfenv.
+var cfenvKeys = []string{
+	"VCAP_APPLICATION", "VCAP_SERVICES",
+	"HOME", "MEMORY_LIMIT", "PWD", "TMPDIR", "USER", "PORT",
+	"CF_INSTANCE_INDEX", "CF_INSTANCE_ADDR", "CF_INSTANCE_IP", "CF_INSTANCE_PORT",
+}
+
+// currentApp reads VCAP_APPLICATION, VCAP_SERVICES and the other cfenv variables
+// from the sources so that they can be provided by any of them, not just the process env,
+// and adds the Kubernetes service bindings in SERVICE_BINDING_ROOT.
+// It returns the errors reading the bindings, see Errors.
+func (r *Settings) currentApp() (*cfenv.App, []error) {
+	env := make(map[string]string)
+	for _, name := range cfenvKeys {
+		switch t := r.getEnv(name).(type) {
+		case string:
+			if t != "" {
+				env[name] = t
+			}
+		default:
+			b, _ := json.Marshal(t)
+			env[name] = string(b)
+		}
+	}
+	app, _ := cfenv.New(env)
+
+	root := r.GetStringEnv(serviceBindingRoot)
+	if root == "" {
+		return app, nil
+	}
+	bindings, errs := readBindings(root)
+	if len(bindings) == 0 {
+		return app, errs
+	}
+	if app == nil {
+		app = &cfenv.App{}
+	}
+	if app.Services == nil {
+		app.Services = cfenv.Services{}
+	}
+	for label, ss := range bindings {
+		app.Services[label] = append(app.Services[label], ss...)
+	}
+	return app, errs
+}
+
+var settings = newAppSettings()
+
+// newAppSettings returns Settings reading DefaultSources and logs the errors reading them,
+// e.g. a syntax error in config.yaml, so that the app does not silently start with defaults.
+func newAppSettings() *Settings {
+	r := NewSettings()
+	for _, err := range r.Errors() {
+		log.Printf("config: %v", err)
+	}
+	return r
+}
 
 func AppSettings() *Settings {
 	return settings
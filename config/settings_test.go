@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsCache(t *testing.T) {
+	env := map[string]string{
+		"go2_test": `{"level": "INFO"}`,
+		"PORT":     "8080",
+	}
+	s := NewSettingsWithLookup(MapLookup(env))
+	assert.Equal(t, "INFO", s.GetStringEnv("go2_test", "level"))
+	assert.Equal(t, 8080, s.GetIntEnv("PORT"))
+
+	env["go2_test"] = `{"level": "DEBUG"}`
+	env["PORT"] = "9090"
+	assert.Equal(t, "INFO", s.GetStringEnv("go2_test", "level"))
+
+	s.Invalidate("go2_test.level")
+	assert.Equal(t, "DEBUG", s.GetStringEnv("go2_test", "level"))
+	assert.Equal(t, 8080, s.GetIntEnv("PORT"))
+
+	s.Reset()
+	assert.Equal(t, 9090, s.GetIntEnv("PORT"))
+
+	s.NoCache = true
+	env["PORT"] = "7070"
+	assert.Equal(t, 7070, s.GetIntEnv("PORT"))
+}
+
+func TestSettingsNoCache(t *testing.T) {
+	env := map[string]string{
+		"go2_config":       `{"no_cache": true}`,
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    `{"postgres": [{"name": "db", "label": "postgres", "credentials": {"uri": "postgres://a"}}]}`,
+	}
+	s := NewSettingsWithLookup(MapLookup(env))
+	assert.True(t, s.NoCache)
+	assert.Equal(t, "postgres://a", s.PostgresUri())
+
+	env["VCAP_SERVICES"] = `{"postgres": [{"name": "db", "label": "postgres", "credentials": {"uri": "postgres://b"}}]}`
+	assert.Equal(t, "postgres://a", s.PostgresUri())
+	s.Reset()
+	assert.Equal(t, "postgres://b", s.PostgresUri())
+}
+
+func TestSettingsIsolated(t *testing.T) {
+	s := NewSettingsWithLookup(MapLookup(nil))
+	assert.Equal(t, "", s.GetStringEnv("PATH"))
+	assert.Nil(t, s.Env)
+}
+
+func TestGetEnvNumbers(t *testing.T) {
+	s := NewSettingsWithLookup(MapLookup(map[string]string{
+		"go2_test": `{"port": 8080, "max": 1e3, "ratio": 2.5, "big": 1e30, "list": [1, 2]}`,
+		"TIMEOUT":  "1e3",
+	}))
+
+	assert.Equal(t, float64(8080), s.GetEnv("go2_test", "port"))
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, s.GetEnv("go2_test", "list"))
+	assert.Equal(t, float64(2), s.GetEnv("go2_test", "$.list[1]"))
+	assert.IsType(t, float64(0), s.GetEnv("go2_test").(map[string]interface{})["max"])
+
+	assert.Equal(t, 8080, s.GetIntEnv("go2_test", "port"))
+	assert.Equal(t, 1000, s.GetIntEnv("go2_test", "max"))
+	assert.Equal(t, 1000, s.GetIntEnv("TIMEOUT"))
+	assert.Equal(t, 0, s.GetIntEnv("go2_test", "ratio"))
+	assert.Equal(t, 0, s.GetIntEnv("go2_test", "big"))
+	assert.Equal(t, "2.5", s.GetStringEnv("go2_test", "ratio"))
+}
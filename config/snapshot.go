@@ -0,0 +1,125 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+// sourceOverride is the name of the source of values given to With.
+const sourceOverride = "override"
+
+// With returns Settings that look up env values in overrides first and then in the sources of r,
+// e.g.
+//
+//   s := settings.With(map[string]interface{}{
+//       "go2_logging": map[string]interface{}{"level": "DEBUG"},
+//       "go2_postgres": `{"connection": {"max_open": 1}}`,
+//   })
+//
+// String values are decoded if they are JSON. The derived Settings has its own cache and
+// subscribers, r is not modified. Flags bound to r apply to it as well.
+// Profiles, Interpolate and NoCache are initialized from the overrides and sources.
+func (r *Settings) With(overrides map[string]interface{}) *Settings {
+	sources := append([]Source{NewMapSource(sourceOverride, overrides)}, r.Sources()...)
+	d := NewSettings(sources...)
+
+	r.Lock()
+	d.flags = copyFlags(r.flags)
+	r.Unlock()
+
+	return d
+}
+
+func copyFlags(flags map[string]*flagValue) map[string]*flagValue {
+	if flags == nil {
+		return nil
+	}
+	m := make(map[string]*flagValue, len(flags))
+	for k, v := range flags {
+		m[k] = v
+	}
+	return m
+}
+
+// Snapshot is the state of Settings saved by Settings.Snapshot.
+type Snapshot struct {
+	env         *cfenv.App
+	bindingErrs []error
+	interpolate bool
+	noCache     bool
+	profiles    []string
+	sources     []Source
+	flags       map[string]*flagValue
+}
+
+// Snapshot saves the sources, options and bound flags of r, e.g. to restore them
+// after a test that initializes packages using AppSettings from in-memory values:
+//
+//   settings := config.AppSettings()
+//   defer settings.Restore(settings.Snapshot())
+//
+//   test := config.NewSettings(config.NewMapSource("test", map[string]interface{}{
+//       "go2_logging": `{"level": "WARN"}`,
+//   }))
+//   settings.Restore(test.Snapshot())
+//
+// Cached values and subscribers are not part of a snapshot.
+func (r *Settings) Snapshot() *Snapshot {
+	r.Lock()
+	defer r.Unlock()
+
+	return &Snapshot{
+		env:         r.Env,
+		bindingErrs: r.bindingErrs,
+		interpolate: r.Interpolate,
+		noCache:     r.NoCache,
+		profiles:    append([]string(nil), r.Profiles...),
+		sources:     append([]Source(nil), r.sources...),
+		flags:       copyFlags(r.flags),
+	}
+}
+
+// Restore sets the sources, options and bound flags of r to those saved by Snapshot,
+// drops cached values and notifies the subscribers of Watch and WatchStruct of any changes,
+// like Reload but without reading the sources again.
+// Parse errors of watched structs are returned as a *ReloadError after all subscribers
+// have been notified.
+func (r *Settings) Restore(s *Snapshot) error {
+	ws := r.subscribers()
+	ws.reload.Lock()
+	defer ws.reload.Unlock()
+
+	r.Lock()
+	r.Env = s.env
+	r.bindingErrs = s.bindingErrs
+	r.Interpolate = s.interpolate
+	r.NoCache = s.noCache
+	r.Profiles = append([]string(nil), s.profiles...)
+	r.sources = append([]Source(nil), s.sources...)
+	r.flags = copyFlags(s.flags)
+	r.cache = make(map[string]interface{})
+	r.Unlock()
+
+	return reloadError(r.notify())
+}
+
+// Override sets AppSettings to AppSettings().With(overrides) and returns a function
+// that restores it, for tests of packages that use AppSettings, e.g.
+//
+//   defer config.Override(map[string]interface{}{
+//       "go2_postgres": `{"connection": {"max_open": 1}}`,
+//   })()
+//
+// Subscribers are notified of changes both times, their errors are ignored;
+// use Snapshot and Restore to check them.
+func Override(overrides map[string]interface{}) (restore func()) {
+	saved := settings.Snapshot()
+	settings.Restore(settings.With(overrides).Snapshot())
+
+	return func() {
+		settings.Restore(saved)
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWith(t *testing.T) {
+	s := NewSettingsWithLookup(MapLookup(map[string]string{
+		"go2_logging":  `{"level": "INFO"}`,
+		"go2_postgres": `{"connection": {"max_open": 10}}`,
+	}))
+
+	type config struct {
+		MaxOpen int `env:"go2_postgres.connection.max_open"`
+		MaxIdle int `env:"go2_postgres.connection.max_idle" envDefault:"2"`
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	assert.NoError(t, s.BindFlags(fs, &config{}))
+	assert.NoError(t, fs.Parse([]string{"-postgres-connection-max-idle", "5"}))
+
+	d := s.With(map[string]interface{}{
+		"go2_logging":  map[string]interface{}{"level": "DEBUG"},
+		"go2_postgres": `{"connection": {"max_open": 1}}`,
+		"go2_profile":  "test",
+	})
+
+	assert.Equal(t, "DEBUG", d.GetStringEnv("go2_logging", "level"))
+	assert.Equal(t, sourceOverride, d.SourceOf("go2_logging"))
+	assert.Equal(t, []string{"test"}, d.Profiles)
+
+	cfg := &config{}
+	assert.NoError(t, d.Parse(cfg))
+	assert.Equal(t, &config{MaxOpen: 1, MaxIdle: 5}, cfg)
+
+	// r is not modified
+	assert.Equal(t, "INFO", s.GetStringEnv("go2_logging", "level"))
+	assert.Empty(t, s.Profiles)
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, &config{MaxOpen: 10, MaxIdle: 5}, cfg)
+
+	// flags bound to the derived Settings are not bound to r
+	type other struct {
+		Level string `env:"go2_logging.level"`
+	}
+	assert.NoError(t, d.BindFlags(flag.NewFlagSet("other", flag.ContinueOnError), &other{}))
+	_, ok := s.flags["go2_logging.level"]
+	assert.False(t, ok)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := NewSettingsWithLookup(MapLookup(map[string]string{
+		"go2_logging": `{"level": "INFO"}`,
+	}))
+	saved := s.Snapshot()
+
+	var levels []interface{}
+	s.Watch("go2_logging.level", func(old, new interface{}) {
+		levels = append(levels, old, new)
+	})
+
+	test := NewSettings(NewMapSource("test", map[string]interface{}{
+		"go2_logging": `{"level": "WARN"}`,
+		"go2_config":  `{"no_cache": true}`,
+	}))
+	assert.NoError(t, s.Restore(test.Snapshot()))
+	assert.Equal(t, "WARN", s.GetStringEnv("go2_logging", "level"))
+	assert.True(t, s.NoCache)
+	assert.Equal(t, "test", s.SourceOf("go2_logging"))
+
+	assert.NoError(t, s.Restore(saved))
+	assert.Equal(t, "INFO", s.GetStringEnv("go2_logging", "level"))
+	assert.False(t, s.NoCache)
+
+	assert.Equal(t, []interface{}{"INFO", "WARN", "WARN", "INFO"}, levels)
+}
+
+func TestOverride(t *testing.T) {
+	level := AppSettings().GetStringEnv("go2_logging", "level")
+
+	restore := Override(map[string]interface{}{
+		"go2_logging": `{"level": "PANIC"}`,
+	})
+	assert.Equal(t, "PANIC", AppSettings().GetStringEnv("go2_logging", "level"))
+
+	restore()
+	assert.Equal(t, level, AppSettings().GetStringEnv("go2_logging", "level"))
+}
+
+func TestZeroSettings(t *testing.T) {
+	s := &Settings{}
+	cancel := s.Watch("go2_logging.level", func(old, new interface{}) {})
+	defer cancel()
+
+	d := s.With(map[string]interface{}{"go2_logging": `{"level": "DEBUG"}`})
+	assert.NoError(t, s.Restore(d.Snapshot()))
+	assert.Equal(t, "DEBUG", s.GetStringEnv("go2_logging", "level"))
+	assert.NoError(t, s.Reload())
+}
+
+func TestRestoreConcurrent(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    testVcapServices,
+		"go2_logging":      `{"level": "INFO"}`,
+	}))
+	saved := s.Snapshot()
+	test := s.With(map[string]interface{}{
+		"go2_logging": `{"level": "WARN"}`,
+		"go2_config":  `{"no_cache": true, "interpolate": true}`,
+		"go2_profile": "test",
+	}).Snapshot()
+
+	type config struct {
+		Level  string `env:"go2_logging.level"`
+		Bucket string `vcap:"my-blobstore,bucket_name"`
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, s.Restore(test))
+			assert.NoError(t, s.Restore(saved))
+			s.Reset()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			assert.Equal(t, "INFO", s.GetStringEnv("go2_logging", "level"))
+			return
+		default:
+		}
+		level := s.GetStringEnv("go2_logging", "level")
+		assert.Contains(t, []string{"INFO", "WARN"}, level)
+		assert.Len(t, s.AllServices(), 2)
+		assert.NotNil(t, s.GetService("my-db"))
+		cfg := &config{}
+		assert.NoError(t, s.Parse(cfg))
+		assert.Equal(t, "bucket", cfg.Bucket)
+		assert.NotEmpty(t, s.String())
+	}
+}
+
+// slowSource delays the lookups of name in a source.
+type slowSource struct {
+	Source
+	name  string
+	delay time.Duration
+}
+
+func (r slowSource) Lookup(name string) (interface{}, bool) {
+	if name == r.name {
+		time.Sleep(r.delay)
+	}
+	return r.Source.Lookup(name)
+}
+
+func TestResetRestoreConcurrent(t *testing.T) {
+	s := NewSettings(NewMapSource("test", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    testVcapServices,
+	}))
+	saved := s.Snapshot()
+	assert.NoError(t, s.Restore(NewSettings(slowSource{NewMapSource("slow", map[string]interface{}{
+		"VCAP_APPLICATION": "{}",
+		"VCAP_SERVICES":    "{}",
+	}), serviceBindingRoot, 20 * time.Millisecond}).Snapshot()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the services are read before the slow SERVICE_BINDING_ROOT
+		s.Reset()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, s.Restore(saved))
+	<-done
+
+	// the services of the restored sources, not those Reset read before
+	assert.Len(t, s.AllServices(), 2)
+}
@@ -0,0 +1,335 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Source provides env values to Settings. Settings consults its sources in order
+// and uses the value of the first source that has it, e.g.
+//
+//   settings := config.NewSettings(
+//       config.NewMapSource("overrides", map[string]interface{}{"PORT": "8080"}),
+//       config.NewEnvSource(),
+//       config.NewDotEnvSource(".env"),
+//       config.NewFileSource("config.yaml"),
+//   )
+//
+// Values not found in any source fall back to envDefault in Parse.
+type Source interface {
+	// Name identifies the source, e.g. "env" or "file:config.yaml".
+	Name() string
+
+	// Lookup returns the value of the env variable name.
+	// The value is a string, which is decoded if it is JSON, or an already decoded JSON value.
+	Lookup(name string) (interface{}, bool)
+}
+
+// Reloader is implemented by sources that can read their values again,
+// see Settings.Reload.
+type Reloader interface {
+	Reload() error
+}
+
+// DefaultSources returns the sources used by NewSettings if none are given:
+// process env, then .env, config.json and config.yaml in the working directory.
+// Missing files are ignored, errors reading the others are returned by Settings.Errors
+// and logged for AppSettings.
+func DefaultSources() []Source {
+	return []Source{
+		NewEnvSource(),
+		NewDotEnvSource(".env"),
+		NewFileSource("config.json"),
+		NewFileSource("config.yaml"),
+	}
+}
+
+// MapSource provides values from a map, e.g. explicit overrides.
+type MapSource struct {
+	name   string
+	values map[string]interface{}
+}
+
+func NewMapSource(name string, values map[string]interface{}) *MapSource {
+	return &MapSource{
+		name:   name,
+		values: values,
+	}
+}
+
+func (r *MapSource) Name() string {
+	return r.name
+}
+
+func (r *MapSource) Lookup(name string) (interface{}, bool) {
+	v, ok := r.values[name]
+	return v, ok
+}
+
+// LookupFunc returns the value of the env variable name and whether it is set, like os.LookupEnv.
+type LookupFunc func(name string) (string, bool)
+
+// MapLookup returns a LookupFunc reading env variables from env.
+func MapLookup(env map[string]string) LookupFunc {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+// EnvSource provides values from the process environment.
+// Empty variables are treated as not set.
+type EnvSource struct {
+	lookup LookupFunc
+}
+
+func NewEnvSource() *EnvSource {
+	return NewEnvSourceWithLookup(os.LookupEnv)
+}
+
+// NewEnvSourceWithLookup returns an EnvSource reading env variables with lookup
+// instead of os.LookupEnv.
+func NewEnvSourceWithLookup(lookup LookupFunc) *EnvSource {
+	return &EnvSource{
+		lookup: lookup,
+	}
+}
+
+func (r *EnvSource) Name() string {
+	return "env"
+}
+
+func (r *EnvSource) Lookup(name string) (interface{}, bool) {
+	v, ok := r.lookup(name)
+	if !ok || v == "" {
+		return nil, false
+	}
+	return v, true
+}
+
+// DotEnvSource provides values from a .env file of KEY=VALUE lines.
+// Blank lines, lines starting with # and an "export " prefix are ignored,
+// double quoted values are unquoted with Go string escapes, single quoted values are taken literally.
+type DotEnvSource struct {
+	path   string
+	values map[string]interface{}
+	err    error
+
+	sync.RWMutex
+}
+
+func NewDotEnvSource(path string) *DotEnvSource {
+	r := &DotEnvSource{path: path}
+	r.Reload()
+	return r
+}
+
+func (r *DotEnvSource) Name() string {
+	return "dotenv:" + r.path
+}
+
+// Path returns the path of the file.
+func (r *DotEnvSource) Path() string {
+	return r.path
+}
+
+func (r *DotEnvSource) Lookup(name string) (interface{}, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	v, ok := r.values[name]
+	return v, ok
+}
+
+// Reload reads the file again.
+func (r *DotEnvSource) Reload() error {
+	values, err := readDotEnv(r.path)
+
+	r.Lock()
+	defer r.Unlock()
+	r.values, r.err = values, err
+	return err
+}
+
+// Err returns the error reading the file, if any. A missing file is not an error.
+func (r *DotEnvSource) Err() error {
+	r.RLock()
+	defer r.RUnlock()
+	return r.err
+}
+
+func readDotEnv(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return values, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return values, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		switch {
+		case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+			if value, err = strconv.Unquote(value); err != nil {
+				return values, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+		case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// FileSource provides values from a JSON or YAML file whose top level keys
+// are env names, e.g.
+//
+//   go2_logging:
+//     level: INFO
+//   go2_postgres:
+//     connection:
+//       max_open: 10
+//
+// The format is chosen by the file extension: .json, .yaml or .yml.
+type FileSource struct {
+	path   string
+	values map[string]interface{}
+	err    error
+
+	sync.RWMutex
+}
+
+func NewFileSource(path string) *FileSource {
+	r := &FileSource{path: path}
+	r.Reload()
+	return r
+}
+
+func (r *FileSource) Name() string {
+	return "file:" + r.path
+}
+
+// Path returns the path of the file.
+func (r *FileSource) Path() string {
+	return r.path
+}
+
+func (r *FileSource) Lookup(name string) (interface{}, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	v, ok := r.values[name]
+	return v, ok
+}
+
+// Reload reads the file again.
+func (r *FileSource) Reload() error {
+	values, err := readFile(r.path)
+
+	r.Lock()
+	defer r.Unlock()
+	r.values, r.err = values, err
+	return err
+}
+
+// Err returns the error reading the file, if any. A missing file is not an error.
+func (r *FileSource) Err() error {
+	r.RLock()
+	defer r.RUnlock()
+	return r.err
+}
+
+func readFile(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return values, err
+	}
+
+	var t interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err = d.Decode(&t)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &t)
+	default:
+		err = fmt.Errorf("unsupported config file type %q", ext)
+	}
+	if err != nil {
+		return values, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if t == nil {
+		return values, nil
+	}
+	m, ok := normalize(t).(map[string]interface{})
+	if !ok {
+		return values, fmt.Errorf("%s: expected an object of env names", path)
+	}
+	return m, nil
+}
+
+// normalize converts decoded YAML into the types produced by decodeEnv:
+// map[string]interface{}, []interface{}, json.Number, bool and string.
+func normalize(t interface{}) interface{} {
+	switch v := t.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprintf("%v", k)] = normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	case int:
+		return json.Number(strconv.Itoa(v))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return t
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "go2-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSourcesPrecedence(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		".env": `
+# comment
+export PORT=9090
+NAME="dot env"
+QUOTED='single $HOME'
+go2_test={"name": "from dotenv"}
+`,
+		"config.json": `{
+  "PORT": 7070,
+  "LEVEL": "debug",
+  "go2_test": {"name": "from json"}
+}`,
+		"config.yaml": `
+LEVEL: info
+MAX: 10
+go2_yaml:
+  connection:
+    max_open: 20
+  urls:
+    - http://a:9200
+    - http://b:9200
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	s := NewSettings(
+		NewMapSource("overrides", map[string]interface{}{"PORT": "8080"}),
+		NewEnvSourceWithLookup(MapLookup(map[string]string{"NAME": "from env"})),
+		NewDotEnvSource(filepath.Join(dir, ".env")),
+		NewFileSource(filepath.Join(dir, "config.json")),
+		NewFileSource(filepath.Join(dir, "config.yaml")),
+		NewFileSource(filepath.Join(dir, "missing.yaml")),
+	)
+
+	assert.Equal(t, 8080, s.GetIntEnv("PORT"))
+	assert.Equal(t, "overrides", s.SourceOf("PORT"))
+	assert.Equal(t, "from env", s.GetStringEnv("NAME"))
+	assert.Equal(t, "env", s.SourceOf("NAME"))
+	assert.Equal(t, "single $HOME", s.GetStringEnv("QUOTED"))
+	assert.Equal(t, "from dotenv", s.GetStringEnv("go2_test", "name"))
+	assert.Equal(t, "dotenv:"+filepath.Join(dir, ".env"), s.SourceOf("go2_test"))
+	assert.Equal(t, "debug", s.GetStringEnv("LEVEL"))
+	assert.Equal(t, "file:"+filepath.Join(dir, "config.json"), s.SourceOf("LEVEL"))
+	assert.Equal(t, 10, s.GetIntEnv("MAX"))
+	assert.Equal(t, "", s.SourceOf("UNDEFINED"))
+
+	type config struct {
+		MaxOpen int      `env:"go2_yaml.connection.max_open"`
+		Urls    []string `env:"go2_yaml.urls"`
+		MaxIdle int      `env:"go2_yaml.connection.max_idle" envDefault:"5"`
+	}
+	cfg := &config{}
+	assert.NoError(t, s.Parse(cfg))
+	assert.Equal(t, 20, cfg.MaxOpen)
+	assert.Equal(t, []string{"http://a:9200", "http://b:9200"}, cfg.Urls)
+	assert.Equal(t, 5, cfg.MaxIdle)
+}
+
+func TestSourceErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		".env":        "NOT A PAIR",
+		"config.json": "[1, 2]",
+		"config.toml": "a = 1",
+	})
+	defer os.RemoveAll(dir)
+
+	assert.Error(t, NewDotEnvSource(filepath.Join(dir, ".env")).Err())
+	assert.Error(t, NewFileSource(filepath.Join(dir, "config.json")).Err())
+	assert.Error(t, NewFileSource(filepath.Join(dir, "config.toml")).Err())
+	assert.NoError(t, NewFileSource(filepath.Join(dir, "missing.json")).Err())
+}
+
+func TestAppSettingsErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": "go2_logging: [",
+	})
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	s := newAppSettings()
+	assert.Len(t, s.Errors(), 1)
+	assert.Contains(t, buf.String(), "config: config.yaml: yaml:")
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Validation rules are declared with tags next to the env tag and are
+// checked after the field has been loaded, e.g.
+//
+//   type ElasticEnv struct {
+//       Urls        []string      `env:"go2_elastic.urls,nonempty" envFormat:"url"`
+//       SniffScheme string        `env:"go2_elastic.sniff.scheme" envOneOf:"http,https"`
+//       Timeout     time.Duration `env:"go2_elastic.timeout" envMin:"1s" envMax:"1m"`
+//       Index       string        `env:"go2_elastic.index" envPattern:"^[a-z0-9_-]+$"`
+//   }
+//
+//   envMin, envMax  bounds of numbers and durations, or of the length of strings and slices
+//   envOneOf        comma separated list of allowed values, compared case insensitively
+//   envPattern      regular expression the value must match
+//   envFormat       "url" or "hostport"
+//   nonempty        env tag option, the loaded value must not be empty
+//
+// Except for nonempty, rules are only checked if the env variable or envDefault is set.
+// For slices, envOneOf, envPattern and envFormat apply to every element.
+
+func validate(field reflect.Value, refType reflect.StructField, isSet bool) error {
+	_, opts := parseKeyForOption(refType.Tag.Get("env"))
+	for _, opt := range opts {
+		if opt == "nonempty" && isEmpty(field) {
+			return errors.New("Value must not be empty")
+		}
+	}
+	if !isSet {
+		return nil
+	}
+	if field.Kind() == reflect.Ptr && !decodable(field.Type()) {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+
+	if min, ok := refType.Tag.Lookup("envMin"); ok {
+		if err := checkBound(field, min, true); err != nil {
+			return err
+		}
+	}
+	if max, ok := refType.Tag.Lookup("envMax"); ok {
+		if err := checkBound(field, max, false); err != nil {
+			return err
+		}
+	}
+
+	var rules []func(string) error
+	if oneOf, ok := refType.Tag.Lookup("envOneOf"); ok {
+		rules = append(rules, func(s string) error {
+			return checkOneOf(s, strings.Split(oneOf, ","))
+		})
+	}
+	if pattern, ok := refType.Tag.Lookup("envPattern"); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, func(s string) error {
+			if !re.MatchString(s) {
+				return fmt.Errorf("Value %q does not match pattern %s", s, pattern)
+			}
+			return nil
+		})
+	}
+	if format, ok := refType.Tag.Lookup("envFormat"); ok {
+		rules = append(rules, func(s string) error {
+			return checkFormat(s, format)
+		})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	for _, s := range elements(field) {
+		for _, rule := range rules {
+			if err := rule(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isEmpty(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return field.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return field.IsNil()
+	}
+	return false
+}
+
+// elements returns the string form of the value or of each element of a slice.
+func elements(field reflect.Value) []string {
+	if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
+		var s []string
+		for i := 0; i < field.Len(); i++ {
+			s = append(s, fmt.Sprint(field.Index(i).Interface()))
+		}
+		return s
+	}
+	return []string{fmt.Sprint(field.Interface())}
+}
+
+// checkBound checks the field against the envMin (min is true) or envMax bound.
+func checkBound(field reflect.Value, bound string, min bool) error {
+	var (
+		value, limit float64
+		err          error
+	)
+
+	switch field.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		value = float64(field.Len())
+		limit, err = strconv.ParseFloat(bound, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		// the bound is parsed like the field itself, e.g. "1s" for durations
+		// or "10MB" for byte sizes.
+		b := reflect.New(field.Type()).Elem()
+		err = set(b, reflect.StructField{}, bound)
+		value, limit = toFloat(field), toFloat(b)
+	default:
+		return ErrUnsupportedType
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case min && value < limit:
+		return fmt.Errorf("Value must not be less than %s", bound)
+	case !min && value > limit:
+		return fmt.Errorf("Value must not be greater than %s", bound)
+	}
+	return nil
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func checkOneOf(s string, values []string) error {
+	for _, v := range values {
+		if strings.EqualFold(s, strings.TrimSpace(v)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Value %q is not one of %s", s, strings.Join(values, ","))
+}
+
+func checkFormat(s, format string) error {
+	switch format {
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Value %q is not an absolute url", s)
+		}
+	case "hostport":
+		_, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return err
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("Value %q has an invalid port", s)
+		}
+	default:
+		return errors.New("Format " + format + " not supported.")
+	}
+	return nil
+}
@@ -25,12 +25,17 @@ import (
 var settings = config.AppSettings()
 var log = logging.Logger()
 
-//TODO add more options?
+// ElasticEnv configures the client. It can be reused for other clusters with an envPrefix tag, e.g.
+//
+//   Logs ElasticEnv `envPrefix:"go2_elastic_logs"`
+//
+// reads go2_elastic_logs.urls instead of go2_elastic.urls.
 type ElasticEnv struct {
-	Urls              []string      `env:"go2_elastic.urls"`
+	Urls              []string      `env:"go2_elastic.urls" envFormat:"url"`
 	HealthcheckEnable bool          `env:"go2_elastic.healthcheck.enable"`
 	SniffEnable       bool          `env:"go2_elastic.sniff.enable"`
-	SniffScheme       string        `env:"go2_elastic.sniff.scheme"`
+	SniffScheme       string        `env:"go2_elastic.sniff.scheme" envOneOf:"http,https"`
+	//TODO add more options?
 }
 
 var client *es.Client
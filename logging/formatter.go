@@ -0,0 +1,129 @@
+// Copyright 2017 The go2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// LoggingEnv configures the log output, see the package doc.
+type LoggingEnv struct {
+	Format          string            `env:"go2_logging.format" envDefault:"text" envOneOf:"text,json,logfmt"`
+	TimestampFormat string            `env:"go2_logging.timestamp_format"`
+	FieldKeys       map[string]string `env:"go2_logging.field_keys"`
+}
+
+// the keys of the fields every entry has
+const (
+	fieldKeyTime  = "time"
+	fieldKeyLevel = "level"
+	fieldKeyMsg   = "msg"
+)
+
+// newFormatter returns the logrus formatter configured by env.
+func newFormatter(env LoggingEnv) logrus.Formatter {
+	// envOneOf accepts the format in any case
+	switch format := strings.ToLower(env.Format); format {
+	case "json", "logfmt":
+		layout := env.TimestampFormat
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return &formatter{
+			json:            format == "json",
+			timestampFormat: layout,
+			fieldKeys:       env.FieldKeys,
+		}
+	}
+	return &logrus.TextFormatter{
+		TimestampFormat: env.TimestampFormat,
+		FullTimestamp:   env.TimestampFormat != "",
+	}
+}
+
+// formatter writes an entry as a JSON object or a logfmt line of key=value pairs,
+// with its keys renamed by fieldKeys, e.g. {"msg": "message", "time": "@timestamp"}.
+type formatter struct {
+	json            bool
+	timestampFormat string
+	fieldKeys       map[string]string
+}
+
+func (r *formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Data))
+	for k, v := range entry.Data {
+		switch k {
+		case fieldKeyTime, fieldKeyLevel, fieldKeyMsg:
+			// don't clobber the entry fields, like the logrus formatters
+			k = "fields." + k
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[r.key(k)] = v
+	}
+
+	// entry fields first in logfmt lines
+	keys := []string{r.key(fieldKeyTime), r.key(fieldKeyLevel), r.key(fieldKeyMsg)}
+	data[keys[0]] = entry.Time.Format(r.timestampFormat)
+	data[keys[1]] = entry.Level.String()
+	data[keys[2]] = entry.Message
+
+	if r.json {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal fields to JSON, %v", err)
+		}
+		return append(b, '\n'), nil
+	}
+
+	var others []string
+	for k := range data {
+		if k != keys[0] && k != keys[1] && k != keys[2] {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+
+	b := &bytes.Buffer{}
+	for i, k := range append(keys, others...) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(data[k]))
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// key returns the renamed key of a field.
+func (r *formatter) key(k string) string {
+	if to, ok := r.fieldKeys[k]; ok && to != "" {
+		return to
+	}
+	return k
+}
+
+// logfmtValue returns v quoted if it is empty or contains spaces, quotes or '='.
+func logfmtValue(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
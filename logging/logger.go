@@ -5,15 +5,26 @@
 // Usage: var log = logging.ContextLogger
 // Setup env JSON value:
 // go2_logging={
-//   "level": "DEBUG"
+//   "level": "DEBUG",
+//   "format": "json",
+//   "timestamp_format": "2006-01-02T15:04:05.000Z07:00",
+//   "field_keys": {
+//     "msg": "message",
+//     "time": "@timestamp"
+//   }
 // }
 // Logging levels: DEBUG, INFO, WARN, ERROR, PANIC, FATAL
 // default is DEBUG
 // FATAL will terminate your app
+// Formats: text, json, logfmt
+// default is text; json and logfmt default to RFC3339 timestamps
+// field_keys renames the time, level and msg keys and other fields in json and logfmt
+// Changes are applied on settings reload.
 package logging
 
 import (
 	"os"
+	"reflect"
 	"github.com/Sirupsen/logrus"
 	"github.com/qiangli/go2/config"
 )
@@ -25,9 +36,12 @@ const go2_logging string = "go2_logging"
 var settings = config.AppSettings()
 
 func init() {
-	//Predix logstash only accepts text from stdout for now
-	//logrus.SetFormatter(&logrusrus.JSONFormatter{})
-	logrus.SetFormatter(&logrus.TextFormatter{})
+	// allow log levels in config structs, e.g. Level logrus.Level `env:"go2_logging.level"`
+	config.RegisterParser(reflect.TypeOf(logrus.Level(0)), func(s string) (interface{}, error) {
+		return logrus.ParseLevel(s)
+	})
+
+	logrus.SetFormatter(logFormatter())
 	logrus.SetOutput(os.Stdout)
 
 	//Logrus has six logging levels: Debug, Info, Warning, Error, Fatal and Panic.
@@ -43,6 +57,24 @@ func init() {
 
 	//
 	contextLogger.Infof("Logrus initialized. log level: %s", level)
+
+	// pick up level and format changes on settings reload
+	settings.Watch(go2_logging, func(old, new interface{}) {
+		logrus.SetFormatter(logFormatter())
+		level := logLevel()
+		logrus.SetLevel(level)
+		contextLogger.Infof("Logrus reloaded. log level: %s", level)
+	})
+}
+
+//default to text if env not valid
+func logFormatter() logrus.Formatter {
+	env := LoggingEnv{}
+	if err := settings.Parse(&env); err != nil {
+		logrus.Errorf("Logrus format error: %v", err)
+		env = LoggingEnv{Format: "text"}
+	}
+	return newFormatter(env)
 }
 
 //default to debug if env not set
@@ -2,6 +2,11 @@ package logging
 
 import (
 	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/qiangli/go2/config"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLog(t *testing.T) {
@@ -19,3 +24,71 @@ func TestLog(t *testing.T) {
 	// Calls os.Exit(1) after logging
 	//log.Fatal("Bye.")
 }
+
+func TestLogLevelReload(t *testing.T) {
+	level := logrus.GetLevel()
+
+	restore := config.Override(map[string]interface{}{
+		"go2_logging": `{"level": "WARN"}`,
+	})
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+
+	restore()
+	assert.Equal(t, level, logrus.GetLevel())
+}
+
+func testEntry() *logrus.Entry {
+	e := logrus.NewEntry(logrus.New()).WithField("user", "jane doe")
+	e.Time = time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	e.Level = logrus.InfoLevel
+	e.Message = "Hello"
+	return e
+}
+
+func TestFormatJSON(t *testing.T) {
+	f := newFormatter(LoggingEnv{
+		Format:    "json",
+		FieldKeys: map[string]string{"msg": "message", "time": "@timestamp"},
+	})
+	b, err := f.Format(testEntry())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"@timestamp":"2017-03-04T05:06:07Z","level":"info","message":"Hello","user":"jane doe"}`+"\n", string(b))
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	f := newFormatter(LoggingEnv{
+		Format:          "logfmt",
+		TimestampFormat: "2006-01-02 15:04:05",
+		FieldKeys:       map[string]string{"level": "severity"},
+	})
+	e := testEntry().WithField("msg", "data")
+	e.Time, e.Level, e.Message = time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC), logrus.InfoLevel, "Hello"
+	b, err := f.Format(e)
+	assert.NoError(t, err)
+	assert.Equal(t, `time="2017-03-04 05:06:07" severity=info msg=Hello fields.msg=data user="jane doe"`+"\n", string(b))
+}
+
+func TestFormatReload(t *testing.T) {
+	restore := config.Override(map[string]interface{}{
+		"go2_logging": `{"format": "json"}`,
+	})
+	_, ok := logrus.StandardLogger().Formatter.(*formatter)
+	assert.True(t, ok)
+
+	restore()
+	_, ok = logrus.StandardLogger().Formatter.(*logrus.TextFormatter)
+	assert.True(t, ok)
+
+	// formats are validated ignoring case
+	restore = config.Override(map[string]interface{}{
+		"go2_logging": `{"format": "JSON"}`,
+	})
+	f, ok := logrus.StandardLogger().Formatter.(*formatter)
+	assert.True(t, ok)
+	assert.True(t, ok && f.json)
+	restore()
+	assert.IsType(t, &formatter{}, newFormatter(LoggingEnv{Format: "Logfmt"}))
+
+	// invalid formats fall back to text
+	assert.IsType(t, &logrus.TextFormatter{}, newFormatter(LoggingEnv{Format: "xml"}))
+}
@@ -6,9 +6,10 @@
 // Setup env JSON value:
 // go2_newrelic={
 //   "enable": true,
-//   "name: "Your_App_Name",
-//   "license: "__YOUR_NEW_RELIC_LICENSE_KEY__"
+//   "name": "Your_App_Name",
+//   "license": "__YOUR_NEW_RELIC_LICENSE_KEY__"
 // }
+// See go2 config doc for all settings.
 //
 package newrelic
 
@@ -29,7 +30,7 @@ var log = logging.Logger()
 type NewRelicEnv struct {
 	Enable  bool          `env:"go2_newrelic.enable"`
 	Name    string        `env:"go2_newrelic.name"`
-	License string        `env:"go2_newrelic.license"`
+	License string        `env:"go2_newrelic.license,secret"`
 }
 
 func init() {